@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/kaezrr/remy-bot/internal/bot"
 	"github.com/kaezrr/remy-bot/internal/config"
+	"github.com/kaezrr/remy-bot/internal/repl"
 	"github.com/kaezrr/remy-bot/internal/store"
 	"github.com/kaezrr/remy-bot/internal/wa"
 	"github.com/rs/zerolog"
@@ -16,6 +21,18 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
+	// remy [repl [flags] | migrate status|up]
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "repl":
+			runREPL(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		}
+	}
+
 	log.Info().Msg("Remy starting up...")
 
 	// Create session directory and data directory
@@ -23,6 +40,88 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to create session directory")
 	}
 
+	cfg, s, db := setup(false)
+
+	claim := func(group string) error {
+		return claimUnassigned(db, group)
+	}
+
+	if err := wa.Run(cfg, s, bot.Handle, claim); err != nil {
+		log.Fatal().Err(err).Msg("whatsapp runtime error")
+	}
+}
+
+func runREPL(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	group := fs.String("group", "repl", "chat name the commands are sent in")
+	verbose := fs.Bool("v", false, "show info logs")
+	memory := fs.Bool("mem", false, "keep everything in memory instead of the database")
+	fs.Parse(args)
+
+	if !*verbose {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	}
+
+	if err := os.MkdirAll("data", 0755); err != nil {
+		log.Fatal().Err(err).Msg("failed to create data directory")
+	}
+
+	cfg, s, db := setup(*memory)
+
+	// Rows from before multi-group support belong to the first target group,
+	// whose chat ID only the WhatsApp runtime can look up, so they are left
+	// for it to claim.
+	if db != nil {
+		warnUnassigned(db)
+	}
+
+	if err := repl.Run(cfg, s, bot.Handle, *group, os.Stdin, os.Stdout); err != nil {
+		log.Fatal().Err(err).Msg("repl error")
+	}
+}
+
+func runMigrate(args []string) {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprintln(os.Stderr, "usage: remy migrate status|up")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load("config.json")
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config file")
+	}
+
+	db, err := store.Open(cfg.Driver, cfg.DataSource())
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open database")
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if args[0] == "up" {
+		if err := store.Migrate(ctx, db, cfg.Driver); err != nil {
+			log.Fatal().Err(err).Msg("migration failed")
+		}
+	}
+
+	statuses, err := store.Status(ctx, db, cfg.Driver)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read schema version")
+	}
+
+	for _, st := range statuses {
+		applied := "pending"
+		if st.Applied {
+			applied = "applied " + st.AppliedAt.Local().Format(time.DateTime)
+		}
+		fmt.Printf("%04d  %-12s  %s\n", st.Version, st.Name, applied)
+	}
+}
+
+// setup loads the config and opens the store. The store is also returned as a
+// *store.DBStore unless it is kept in memory.
+func setup(inMemory bool) (*config.Config, store.Store, *store.DBStore) {
 	cfg, err := config.Load("config.json")
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to load config file")
@@ -40,12 +139,55 @@ func main() {
 		Int("offset_seconds", offset).
 		Msg("Timezone info")
 
-	s, err := store.NewDBStore(cfg.Database, timezone)
+	var reminders []time.Duration
+	if len(cfg.DefaultReminders) > 0 {
+		reminders, err = store.ParseReminders(strings.Join(cfg.DefaultReminders, ","))
+		if err != nil {
+			log.Fatal().Err(err).Msg("invalid default_reminders")
+		}
+	}
+
+	if inMemory {
+		return cfg, store.NewMemStore(timezone, reminders), nil
+	}
+
+	s, err := store.NewDBStore(cfg.Driver, cfg.DataSource(), timezone, reminders)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start database")
 	}
 
-	if err := wa.Run(cfg, s, bot.Handle); err != nil {
-		log.Fatal().Err(err).Msg("whatsapp runtime error")
+	return cfg, s, s
+}
+
+// claimUnassigned moves the deadlines and baskets from before multi-group
+// support into group, the first target group.
+func claimUnassigned(db *store.DBStore, group string) error {
+	claimed, err := db.ClaimUnassigned(context.Background(), group)
+	if err != nil {
+		return err
+	}
+
+	if claimed > 0 {
+		log.Info().
+			Int("rows", claimed).
+			Str("group_jid", group).
+			Msg("assigned pre-multi-group deadlines and baskets")
+	}
+	return nil
+}
+
+// warnUnassigned tells about deadlines and baskets that are in no group, and
+// so can't be seen from the REPL.
+func warnUnassigned(db *store.DBStore) {
+	n, err := db.CountUnassigned(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to count unassigned deadlines and baskets")
+		return
+	}
+
+	if n > 0 {
+		log.Warn().
+			Int("rows", n).
+			Msg("deadlines and baskets from before multi-group support stay hidden until the bot moves them into its first target group")
 	}
 }
@@ -0,0 +1,188 @@
+// Package app connects a chat transport to the bot.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/bot"
+	"github.com/kaezrr/remy-bot/internal/chat"
+	"github.com/kaezrr/remy-bot/internal/media"
+	"github.com/kaezrr/remy-bot/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+type HandleFunc func(ctx context.Context, req bot.Request, prefix string, s store.Store) bot.Response
+
+// Attachments bigger than this can't be pinned.
+const MaxAttachmentSize = 100 << 20
+
+// Commands may download an attachment, so they get a while to finish.
+const handleTimeout = 2 * time.Minute
+
+// How many messages to one chat can wait to be handled before Enqueue
+// blocks.
+const queueSize = 64
+
+// Dispatcher runs incoming messages through the bot and replies with the
+// result. Messages from chats not in Chats are ignored.
+type Dispatcher struct {
+	Messenger chat.Messenger
+	Store     store.Store
+	Handle    HandleFunc
+	Prefix    string
+	Chats     map[string]bool
+	Media     media.Dir // where attachments are saved
+
+	mu     sync.Mutex
+	queues map[string]chan chat.Message
+}
+
+// Enqueue dispatches msg in the background, so that transports delivering
+// events one at a time are not held up by a slow command. Messages to the
+// same chat are still handled one after another, in order.
+func (d *Dispatcher) Enqueue(msg chat.Message) {
+	if msg.IsFromMe || !d.Chats[msg.Chat] || msg.Text == "" {
+		return
+	}
+
+	d.mu.Lock()
+	q, ok := d.queues[msg.Chat]
+	if !ok {
+		if d.queues == nil {
+			d.queues = map[string]chan chat.Message{}
+		}
+		q = make(chan chat.Message, queueSize)
+		d.queues[msg.Chat] = q
+
+		go func() {
+			for m := range q {
+				d.Dispatch(m)
+			}
+		}()
+	}
+	d.mu.Unlock()
+
+	q <- msg
+}
+
+func (d *Dispatcher) Dispatch(msg chat.Message) {
+	if msg.IsFromMe || !d.Chats[msg.Chat] || msg.Text == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), handleTimeout)
+	defer cancel()
+
+	var quoted *bot.Quoted
+	switch {
+	case msg.Quoted != nil:
+		q := msg.Quoted
+		quoted = &bot.Quoted{ID: q.ID, Sender: q.Sender, Text: q.Text, SentAt: q.Time, Attachment: d.attachment(q.Attachment)}
+	case msg.Attachment != nil:
+		// A file whose caption is a command is handled as if the command
+		// replied to it.
+		quoted = &bot.Quoted{ID: msg.ID, Sender: msg.Sender, SentAt: msg.Time, Attachment: d.attachment(msg.Attachment)}
+	}
+
+	req := bot.Request{
+		Text:      msg.Text,
+		Chat:      msg.Chat,
+		MessageID: msg.ID,
+		Sender:    bot.Sender{ID: msg.Sender, Name: msg.SenderName},
+		SentAt:    msg.Time,
+		Quoted:    quoted,
+	}
+
+	if ac, ok := d.Messenger.(chat.AdminChecker); ok {
+		req.Sender.GroupAdmin = func(ctx context.Context) bool {
+			admin, err := ac.IsAdmin(ctx, msg.Chat, msg.Sender)
+			if err != nil {
+				log.Error().Err(err).Str("chat", msg.Chat).Msg("failed to look up group admins")
+			}
+			return admin
+		}
+	}
+
+	resp := d.Handle(ctx, req, d.Prefix, d.Store)
+	if resp.Text == "" && resp.Media == nil {
+		return
+	}
+
+	if resp.Media != nil {
+		d.sendMedia(ctx, msg, *resp.Media, resp.Text)
+		return
+	}
+
+	var err error
+	if r := resp.ReplyTo; r != nil {
+		err = d.Messenger.SendReply(ctx, chat.Message{ID: r.ID, Chat: msg.Chat, Sender: r.Sender, Text: r.Text}, resp.Text)
+	} else {
+		err = d.Messenger.SendText(ctx, msg.Chat, resp.Text)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("chat", msg.Chat).Msg("failed to send reply")
+	}
+}
+
+// attachment lets the bot save a to the media directory.
+func (d *Dispatcher) attachment(a *chat.Attachment) *bot.Attachment {
+	if a == nil {
+		return nil
+	}
+
+	tooLarge := fmt.Errorf("the file is too large, the limit is %d MB", MaxAttachmentSize>>20)
+
+	return &bot.Attachment{
+		Kind: a.Kind,
+		MIME: a.MIME,
+		Name: a.Name,
+		Save: func(ctx context.Context) (string, error) {
+			if a.Size > MaxAttachmentSize {
+				return "", tooLarge
+			}
+
+			data, err := a.Download(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to download attachment")
+				return "", errors.New("could not download the file, it may be too old")
+			}
+			if len(data) > MaxAttachmentSize {
+				return "", tooLarge
+			}
+
+			return d.Media.Put(data)
+		},
+	}
+}
+
+// sendMedia sends the file m from the media directory to the chat of msg.
+func (d *Dispatcher) sendMedia(ctx context.Context, msg chat.Message, m store.PinMedia, caption string) {
+	reply := func(text string) {
+		if err := d.Messenger.SendText(ctx, msg.Chat, text); err != nil {
+			log.Error().Err(err).Str("chat", msg.Chat).Msg("failed to send reply")
+		}
+	}
+
+	sender, ok := d.Messenger.(chat.MediaSender)
+	if !ok {
+		reply("files can't be sent here")
+		return
+	}
+
+	data, err := d.Media.Read(m.SHA256)
+	if err != nil {
+		log.Error().Err(err).Str("sha256", m.SHA256).Msg("failed to read attachment")
+		reply("the file of this pin is missing")
+		return
+	}
+
+	file := chat.File{Kind: m.Kind, MIME: m.MIME, Name: m.Name, Data: data}
+	if err := sender.SendMedia(ctx, msg.Chat, file, caption); err != nil {
+		log.Error().Err(err).Str("chat", msg.Chat).Msg("failed to send file")
+		reply("could not send the file")
+	}
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/bot"
+	"github.com/kaezrr/remy-bot/internal/chat"
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+type sentMessage struct {
+	chat    string
+	replyTo string // ID of the quoted message, empty for plain text
+	text    string
+}
+
+type fakeMessenger struct {
+	mu     sync.Mutex
+	sent   []sentMessage
+	notify chan sentMessage // receives every message sent, if not nil
+}
+
+func (m *fakeMessenger) send(s sentMessage) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, s)
+	m.mu.Unlock()
+
+	if m.notify != nil {
+		m.notify <- s
+	}
+	return nil
+}
+
+func (m *fakeMessenger) SendText(ctx context.Context, chatID string, text string) error {
+	return m.send(sentMessage{chat: chatID, text: text})
+}
+
+func (m *fakeMessenger) SendReply(ctx context.Context, msg chat.Message, text string) error {
+	return m.send(sentMessage{chat: msg.Chat, replyTo: msg.ID, text: text})
+}
+
+func (m *fakeMessenger) React(ctx context.Context, msg chat.Message, emoji string) error {
+	return nil
+}
+
+func (m *fakeMessenger) ResolveChat(ctx context.Context, name string) (string, error) {
+	return name, nil
+}
+
+func echo(ctx context.Context, req bot.Request, prefix string, s store.Store) bot.Response {
+	switch req.Text {
+	case "quiet":
+		return bot.Response{}
+	case "quote":
+		return bot.Response{Text: "this one", ReplyTo: &bot.Quoted{ID: "7", Sender: "someone"}}
+	}
+	return bot.Response{Text: "got " + req.Text}
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  chat.Message
+		want []sentMessage
+	}{
+		{"reply", chat.Message{ID: "1", Chat: "g", Text: ".h"}, []sentMessage{{chat: "g", text: "got .h"}}},
+		{"quoting another message", chat.Message{ID: "1", Chat: "g", Text: "quote"}, []sentMessage{{chat: "g", replyTo: "7", text: "this one"}}},
+		{"nothing to say", chat.Message{ID: "1", Chat: "g", Text: "quiet"}, nil},
+		{"other chat", chat.Message{ID: "1", Chat: "other", Text: ".h"}, nil},
+		{"own message", chat.Message{ID: "1", Chat: "g", Text: ".h", IsFromMe: true}, nil},
+		{"no text", chat.Message{ID: "1", Chat: "g"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &fakeMessenger{}
+			d := Dispatcher{Messenger: m, Handle: echo, Prefix: ".", Chats: map[string]bool{"g": true}}
+
+			d.Dispatch(tt.msg)
+
+			if !slices.Equal(m.sent, tt.want) {
+				t.Errorf("sent %+v, want %+v", m.sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnqueueKeepsChatsApart(t *testing.T) {
+	release := make(chan struct{})
+	handle := func(ctx context.Context, req bot.Request, prefix string, s store.Store) bot.Response {
+		if req.Text == "slow" {
+			<-release
+		}
+		return bot.Response{Text: req.Text}
+	}
+
+	m := &fakeMessenger{notify: make(chan sentMessage, 4)}
+	d := Dispatcher{Messenger: m, Handle: handle, Prefix: ".", Chats: map[string]bool{"a": true, "b": true}}
+
+	next := func() sentMessage {
+		t.Helper()
+		select {
+		case s := <-m.notify:
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("nothing was sent")
+			return sentMessage{}
+		}
+	}
+
+	d.Enqueue(chat.Message{ID: "1", Chat: "a", Text: "slow"})
+	d.Enqueue(chat.Message{ID: "2", Chat: "a", Text: "after slow"})
+	d.Enqueue(chat.Message{ID: "3", Chat: "b", Text: "fast"})
+
+	// Chat b is answered while chat a waits on its slow command.
+	if s := next(); s.chat != "b" {
+		t.Fatalf("first reply went to %+v, want chat b", s)
+	}
+
+	close(release)
+	for _, want := range []string{"slow", "after slow"} {
+		if s := next(); s.chat != "a" || s.text != want {
+			t.Fatalf("sent %+v, want %q to chat a", s, want)
+		}
+	}
+}
+
+type adminMessenger struct {
+	fakeMessenger
+	lookups int
+}
+
+func (m *adminMessenger) IsAdmin(ctx context.Context, chatID string, user string) (bool, error) {
+	m.lookups++
+	return true, nil
+}
+
+func TestDispatchLooksUpAdminsOnlyWhenNeeded(t *testing.T) {
+	s := store.NewMemStore(time.UTC, nil)
+	m := &adminMessenger{}
+	d := Dispatcher{Messenger: m, Store: s, Handle: bot.Handle, Prefix: ".", Chats: map[string]bool{"g": true}}
+
+	tests := []struct {
+		text    string
+		lookups int
+	}{
+		{"hello", 0},
+		{".b add notes", 0},
+		{".b get", 0},
+		{".b del notes", 1},
+	}
+
+	for _, tt := range tests {
+		d.Dispatch(chat.Message{ID: "1", Chat: "g", Sender: "1@s.whatsapp.net", Text: tt.text})
+		if m.lookups != tt.lookups {
+			t.Errorf("after %q looked up admins %d times, want %d", tt.text, m.lookups, tt.lookups)
+		}
+	}
+
+	if last := m.sent[len(m.sent)-1]; !strings.HasPrefix(last.text, "basket moved to the trash") {
+		t.Errorf("admin's .b del got %q", last.text)
+	}
+}
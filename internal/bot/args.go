@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Arg is one argument of a command.
+type Arg struct {
+	Text string // with quotes and escapes removed
+	// Quoted is whether any of the argument was quoted or escaped, so that
+	// a quoted word is not taken for a keyword.
+	Quoted  bool
+	rest    string // the message from the start of the argument on
+	wrapped bool   // whether the whole argument is in one pair of quotes
+}
+
+// Option returns the value of an option such as repeat:daily if a is one.
+// The name must be typed as it is, so "repeat:daily" in quotes is not an
+// option, while the value may be quoted as in in:"reading list".
+func (a Arg) Option(name string) (string, bool) {
+	if !strings.HasPrefix(a.rest, name+":") {
+		return "", false
+	}
+	return strings.CutPrefix(a.Text, name+":")
+}
+
+// Args are the arguments of a command, split by parseArgs.
+type Args []Arg
+
+// Strings returns the text of every argument.
+func (a Args) Strings() []string {
+	words := make([]string, len(a))
+	for i, arg := range a {
+		words[i] = arg.Text
+	}
+	return words
+}
+
+// Join joins the text of every argument with spaces.
+func (a Args) Join() string {
+	return strings.Join(a.Strings(), " ")
+}
+
+// Rest returns the message from argument i on exactly as it was sent, so
+// newlines, spacing and quotes are kept. A last argument wrapped in quotes is
+// returned without them. Rest is empty if there are no more than i arguments.
+func (a Args) Rest(i int) string {
+	if i >= len(a) {
+		return ""
+	}
+	if i == len(a)-1 && a[i].wrapped {
+		return a[i].Text
+	}
+	return strings.TrimRightFunc(a[i].rest, unicode.IsSpace)
+}
+
+// isQuote reports whether r opens or closes a quoted argument. Phones often
+// turn " into curly quotes, so those count too.
+func isQuote(r rune) bool {
+	return r == '"' || r == '“' || r == '”'
+}
+
+// parseArgs splits s into arguments at whitespace, like a shell. Text in
+// double quotes is kept together, and a backslash takes the next character
+// as it is. A quote that is never closed is taken as it is, so a stray one
+// in a pin or title does not need escaping.
+func parseArgs(s string) Args {
+	var (
+		args  Args
+		runes []rune
+		// offsets[i] is where runes[i] starts in s.
+		offsets []int
+	)
+
+	for off, r := range s {
+		runes = append(runes, r)
+		offsets = append(offsets, off)
+	}
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		var (
+			text   strings.Builder
+			quoted bool
+		)
+
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			switch r := runes[i]; {
+			case r == '\\' && i+1 < len(runes):
+				text.WriteRune(runes[i+1])
+				quoted = true
+				i += 2
+
+			case isQuote(r) && closingQuote(runes, i+1) >= 0:
+				end := closingQuote(runes, i+1)
+				for j := i + 1; j < end; j++ {
+					if escapes(runes, j) {
+						j++
+					}
+					text.WriteRune(runes[j])
+				}
+				quoted = true
+				i = end + 1
+
+			default:
+				text.WriteRune(r)
+				i++
+			}
+		}
+
+		wrapped := isQuote(runes[start]) && closingQuote(runes, start+1) == i-1
+		args = append(args, Arg{Text: text.String(), Quoted: quoted, rest: s[offsets[start]:], wrapped: wrapped})
+	}
+
+	return args
+}
+
+// closingQuote returns the index of the quote closing a quoted argument whose
+// text starts at runes[from], or -1 if it is never closed.
+func closingQuote(runes []rune, from int) int {
+	for j := from; j < len(runes); j++ {
+		switch {
+		case escapes(runes, j):
+			j++
+		case isQuote(runes[j]):
+			return j
+		}
+	}
+	return -1
+}
+
+// escapes reports whether runes[j] is a backslash escaping the next rune
+// inside quotes, where only quotes and backslashes can be escaped.
+func escapes(runes []rune, j int) bool {
+	return runes[j] == '\\' && j+1 < len(runes) && (isQuote(runes[j+1]) || runes[j+1] == '\\')
+}
+
+// quote quotes s if it would not be read back as a single argument, for
+// replies that suggest a command.
+func quote(s string) string {
+	args := parseArgs(s)
+	if len(args) == 1 && !args[0].Quoted && args[0].Text == s {
+		return s
+	}
+
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range s {
+		if isQuote(r) || r == '\\' {
+			out.WriteByte('\\')
+		}
+		out.WriteRune(r)
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   []string
+		quoted []bool
+	}{
+		{"", nil, nil},
+		{"  a  b\tc\n", []string{"a", "b", "c"}, []bool{false, false, false}},
+		{`add "reading list"`, []string{"add", "reading list"}, []bool{false, true}},
+		{`in:"reading list" x`, []string{"in:reading list", "x"}, []bool{true, false}},
+		{`“curly quotes” x`, []string{"curly quotes", "x"}, []bool{true, false}},
+		{`a\ b \"c`, []string{"a b", `"c`}, []bool{true, true}},
+		{`"say \"hi\"" "back\\slash"`, []string{`say "hi"`, `back\slash`}, []bool{true, true}},
+		{`"keep \n as is"`, []string{`keep \n as is`}, []bool{true}},
+		{`5'10" tall`, []string{`5'10"`, "tall"}, []bool{false, false}},
+		{`"never closed`, []string{`"never`, "closed"}, []bool{false, false}},
+		{`""`, []string{""}, []bool{true}},
+		{`trailing\`, []string{`trailing\`}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		args := parseArgs(tt.in)
+
+		if got := args.Strings(); !slices.Equal(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+
+		for i, arg := range args {
+			if arg.Quoted != tt.quoted[i] {
+				t.Errorf("parseArgs(%q)[%d].Quoted = %v, want %v", tt.in, i, arg.Quoted, tt.quoted[i])
+			}
+		}
+	}
+}
+
+func TestArgsRest(t *testing.T) {
+	tests := []struct {
+		in   string
+		i    int
+		want string
+	}{
+		{"notes line one\n  line two  \n", 1, "line one\n  line two"},
+		{`notes he said "hi"`, 1, `he said "hi"`},
+		{`notes "repeat:daily"`, 1, "repeat:daily"},
+		{`notes "a" "b"`, 1, `"a" "b"`},
+		{`notes \o/`, 1, `\o/`},
+		{`notes "a"b`, 1, `"a"b`},
+		{"notes", 1, ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseArgs(tt.in).Rest(tt.i); got != tt.want {
+			t.Errorf("parseArgs(%q).Rest(%d) = %q, want %q", tt.in, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestArgOption(t *testing.T) {
+	tests := []struct {
+		in    string
+		value string
+		ok    bool
+	}{
+		{"repeat:daily", "daily", true},
+		{`repeat:"every day"`, "every day", true},
+		{`"repeat:daily"`, "", false},
+		{`\repeat:daily`, "", false},
+		{"repeats:daily", "", false},
+		{"daily", "", false},
+	}
+
+	for _, tt := range tests {
+		value, ok := parseArgs(tt.in)[0].Option("repeat")
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("Option(%q) = %q, %v, want %q, %v", tt.in, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"notes", "reading list", `say "hi"`, `back\slash`, "", "in:x"} {
+		got := quote(s)
+		if args := parseArgs(got); len(args) != 1 || args[0].Text != s {
+			t.Errorf("quote(%q) = %s, which reads back as %q", s, got, args.Strings())
+		}
+	}
+	if got := quote("notes"); got != "notes" {
+		t.Errorf("quote(notes) = %s, want it unquoted", got)
+	}
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// listOptions are the words that can follow .d get and .p get.
+type listOptions struct {
+	who bool   // show who added and edited each item
+	by  string // only list items added by this user, if set
+}
+
+func parseListOptions(args Args) (listOptions, error) {
+	var opts listOptions
+
+	for _, arg := range args {
+		if v, ok := arg.Option("by"); ok {
+			opts.by = userID(strings.TrimPrefix(v, "@"))
+			if opts.by == "" {
+				return listOptions{}, errors.New("missing member after by:, e.g. by:@alice")
+			}
+			continue
+		}
+
+		if arg.Text == "who" && !arg.Quoted {
+			opts.who = true
+			continue
+		}
+
+		return listOptions{}, fmt.Errorf("could not read %q, use who or by:@member", arg.Text)
+	}
+
+	return opts, nil
+}
+
+// keep reports whether an item with attribution a is listed.
+func (o listOptions) keep(a store.Attribution) bool {
+	return o.by == "" || a.CreatedBy == o.by
+}
+
+// describeAttribution says who added something and who edited it last. It
+// is empty for items from before that was recorded.
+func describeAttribution(a store.Attribution, tz *time.Location) string {
+	var parts []string
+
+	if a.CreatedBy != "" {
+		added := "added by " + mention(a.CreatedBy)
+		if !a.CreatedAt.IsZero() {
+			added += " on " + a.CreatedAt.In(tz).Format(store.DisplayFormat)
+		}
+		parts = append(parts, added)
+	}
+	if a.UpdatedBy != "" {
+		parts = append(parts, "edited by "+mention(a.UpdatedBy))
+	}
+
+	return strings.Join(parts, ", ")
+}
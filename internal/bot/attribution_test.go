@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+func TestParseListOptions(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    listOptions
+		wantErr bool
+	}{
+		{"", listOptions{}, false},
+		{"who", listOptions{who: true}, false},
+		{"by:@911234567890", listOptions{by: "911234567890"}, false},
+		{"who by:911234567890@s.whatsapp.net", listOptions{who: true, by: "911234567890"}, false},
+		{`"who"`, listOptions{}, true},
+		{"by:", listOptions{}, true},
+		{"everything", listOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseListOptions(parseArgs(tt.in))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseListOptions(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDescribeAttribution(t *testing.T) {
+	at := time.Date(2025, time.March, 3, 14, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		a    store.Attribution
+		want string
+	}{
+		{store.Attribution{}, ""},
+		{store.Attribution{CreatedBy: "1", CreatedAt: at}, "added by @1 on Mon, Mar 3 at 2:05 PM"},
+		{store.Attribution{CreatedBy: "1", CreatedAt: at, UpdatedBy: "2"}, "added by @1 on Mon, Mar 3 at 2:05 PM, edited by @2"},
+		{store.Attribution{UpdatedBy: "2"}, "edited by @2"},
+	}
+
+	for _, tt := range tests {
+		if got := describeAttribution(tt.a, time.UTC); got != tt.want {
+			t.Errorf("describeAttribution(%+v) = %q, want %q", tt.a, got, tt.want)
+		}
+	}
+}
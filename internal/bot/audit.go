@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// .audit shows this many changes unless asked for another number, and never
+// more than auditMax.
+const (
+	auditDefault = 10
+	auditMax     = 50
+)
+
+// Titles, descriptions and pins are cut to this many characters in .audit.
+const auditSnippet = 60
+
+// pinSnapshot is how pins are kept in the audit log, with their position so
+// that .p pos shows up.
+type pinSnapshot struct {
+	store.Pin
+	Position int `json:",omitempty"`
+}
+
+// auditChange is what a command did to one entity, for the audit log. before
+// and after are kept as JSON, and are nil when the entity did not exist before
+// or does not exist after.
+type auditChange struct {
+	target        string
+	before, after any
+}
+
+// audited makes a change for the command in req and records it in the audit
+// log together, so that a change is only kept if it is recorded. do makes the
+// change with the store it is given, looking up the entity as it was before
+// with it too so that nothing changes it in between. do may run more than
+// once, so it must leave what it captures as it was.
+func audited(ctx context.Context, req Request, s store.Store, entity string, do func(s store.Store) (auditChange, error)) error {
+	return s.WithAudit(ctx, req.Chat, func(s store.Store) (store.AuditEntry, error) {
+		c, err := do(s)
+		if err != nil {
+			return store.AuditEntry{}, err
+		}
+
+		return store.AuditEntry{
+			Actor:   userID(req.Sender.ID),
+			Command: req.command,
+			Entity:  entity,
+			Target:  c.target,
+			Before:  snapshot(c.before),
+			After:   snapshot(c.after),
+		}, nil
+	})
+}
+
+func snapshot(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(b)
+}
+
+// pinPosition returns where pin is in its basket, counting from 1, or 0 if
+// it isn't there.
+func pinPosition(ctx context.Context, s store.Store, group string, pin store.Pin) (int, error) {
+	pins, err := s.ListPins(ctx, group, pin.Basket)
+	if err != nil {
+		return 0, err
+	}
+	return slices.IndexFunc(pins, func(p store.Pin) bool { return p.ID == pin.ID }) + 1, nil
+}
+
+// pinChange returns the change to the pin in before, looking it up again for
+// its new state. withPosition keeps where the pin is in its basket too.
+func pinChange(ctx context.Context, s store.Store, group string, before pinSnapshot, withPosition bool) (auditChange, error) {
+	pin, err := s.GetPin(ctx, group, before.ID)
+	if err != nil {
+		return auditChange{}, err
+	}
+
+	after := pinSnapshot{Pin: pin}
+	if withPosition {
+		if after.Position, err = pinPosition(ctx, s, group, pin); err != nil {
+			return auditChange{}, err
+		}
+	}
+
+	return auditChange{target: strconv.Itoa(before.ID), before: before, after: after}, nil
+}
+
+func auditCommand(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	n := auditDefault
+	if len(args) > 0 {
+		var err error
+		n, err = strconv.Atoi(args[0].Text)
+		if err != nil || n < 1 {
+			return Response{}, errors.New("n must be a positive integer")
+		}
+		n = min(n, auditMax)
+	}
+
+	entries, err := s.ListAuditEntries(ctx, req.Chat, n)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(entries) == 0 {
+		return Response{Text: "no changes recorded yet"}, nil
+	}
+
+	tz := s.Timezone()
+	var out strings.Builder
+	out.WriteString("recent changes:\n")
+	for _, e := range entries {
+		fmt.Fprintf(&out, "- %s: %s %s%s on %s\n", e.At.In(tz).Format(store.DisplayFormat), mention(e.Actor), req.prefix, e.Command, describeTarget(e))
+		if change := describeChange(e, tz); change != "" {
+			out.WriteString("   " + change + "\n")
+		}
+	}
+
+	return Response{Text: out.String()}, nil
+}
+
+func describeTarget(e store.AuditEntry) string {
+	switch e.Entity {
+	case "deadline", "pin":
+		return e.Entity + " #" + e.Target
+	case "role":
+		return "the role of " + mention(e.Target)
+	}
+	return e.Entity + " " + e.Target
+}
+
+// describeChange sums up the snapshots of e, as "before -> after" if both
+// exist and differ.
+func describeChange(e store.AuditEntry, tz *time.Location) string {
+	before, after := describeSnapshot(e.Entity, e.Before, tz), describeSnapshot(e.Entity, e.After, tz)
+
+	switch {
+	case before == "":
+		return after
+	case after == "" || after == before:
+		return before
+	}
+	return before + " -> " + after
+}
+
+// shorten puts s on one line and cuts it to auditSnippet characters.
+func shorten(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > auditSnippet {
+		return string(r[:auditSnippet-3]) + "..."
+	}
+	return s
+}
+
+// describeSnapshot sums up a snapshot of entity. Only free text is shortened,
+// so that a change to anything else always shows.
+func describeSnapshot(entity, js string, tz *time.Location) string {
+	if js == "" {
+		return ""
+	}
+
+	switch entity {
+	case "deadline":
+		var d store.Deadline
+		if json.Unmarshal([]byte(js), &d) == nil {
+			text := fmt.Sprintf("%s (%s)", shorten(d.Title), d.DueAt.In(tz).Format(store.DisplayFormat))
+			if d.Recurrence.Repeats() {
+				text += ", repeats " + describeRecurrence(d.Recurrence, tz)
+			}
+			return text + ", reminders: " + describeReminders(d.Reminders)
+		}
+
+	case "basket":
+		var b store.Basket
+		if json.Unmarshal([]byte(js), &b) == nil {
+			text := b.Name
+			if b.Description != "" {
+				text += ": " + shorten(b.Description)
+			}
+			if !b.DeletedAt.IsZero() {
+				text += " (in the trash)"
+			}
+			return text
+		}
+
+	case "pin":
+		var p pinSnapshot
+		if json.Unmarshal([]byte(js), &p) == nil {
+			text := p.Basket + ": " + shorten(pinText(p.Pin))
+			if p.Position > 0 {
+				text += fmt.Sprintf(" (position %d)", p.Position)
+			}
+			return text
+		}
+
+	case "role":
+		var r store.RoleAssignment
+		if json.Unmarshal([]byte(js), &r) == nil {
+			return string(r.Role)
+		}
+	}
+
+	return shorten(js)
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+func isAdmin(ctx context.Context) bool { return true }
+
+func TestHandleRecordsChanges(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+
+	for _, text := range []string{
+		".b add notes",
+		".p add notes first",
+		".p edit 1 second",
+		".p del 1",
+		".p del 7",
+		".role set @2 moderator",
+		".b desc notes things to read",
+	} {
+		req := Request{Text: text, Chat: "g", Sender: Sender{ID: "1:3@s.whatsapp.net", GroupAdmin: isAdmin}}
+		Handle(ctx, req, ".", s)
+	}
+
+	entries, err := s.ListAuditEntries(ctx, "g", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		command, entity, target string
+		before, after           bool
+	}{
+		{"b desc", "basket", "notes", true, true},
+		{"role set", "role", "2", false, true},
+		{"p del", "pin", "1", true, false},
+		{"p edit", "pin", "1", true, true},
+		{"p add", "pin", "1", false, true},
+		{"b add", "basket", "notes", false, true},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Actor != "1" || e.Command != w.command || e.Entity != w.entity || e.Target != w.target ||
+			(e.Before != "") != w.before || (e.After != "") != w.after {
+			t.Errorf("entry %d = %+v, want %+v by 1", i, e, w)
+		}
+	}
+
+	req := Request{Text: ".audit 2", Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net", GroupAdmin: isAdmin}}
+	got := Handle(ctx, req, ".", s).Text
+	for _, line := range []string{
+		"@1 .b desc on basket notes\n   notes -> notes: things to read\n",
+		"@1 .role set on the role of @2\n   moderator\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf(".audit 2 = %q, want it to contain %q", got, line)
+		}
+	}
+	if strings.Contains(got, ".p del") {
+		t.Errorf(".audit 2 = %q, want only 2 changes", got)
+	}
+}
+
+// unrecorded is a store that fails to record any change.
+type unrecorded struct {
+	store.Store
+}
+
+func (s unrecorded) WithAudit(ctx context.Context, group string, change func(s store.Store) (store.AuditEntry, error)) error {
+	return s.Store.WithAudit(ctx, group, func(s store.Store) (store.AuditEntry, error) {
+		if _, err := change(s); err != nil {
+			return store.AuditEntry{}, err
+		}
+		return store.AuditEntry{}, errors.New("audit log is full")
+	})
+}
+
+func TestHandleKeepsOnlyRecordedChanges(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+
+	req := Request{Text: ".b add notes", Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net"}}
+	if got := Handle(ctx, req, ".", unrecorded{s}).Text; !strings.Contains(got, "audit log is full") {
+		t.Errorf(".b add = %q, want the error recording it", got)
+	}
+
+	if baskets, _ := s.ListBaskets(ctx, "g"); len(baskets) != 0 {
+		t.Errorf("baskets = %+v, want none as the change was not recorded", baskets)
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		e    store.AuditEntry
+		want string
+	}{
+		{store.AuditEntry{Entity: "basket", After: `{"Name":"notes"}`}, "notes"},
+		{store.AuditEntry{Entity: "basket", Before: `{"Name":"notes"}`}, "notes"},
+		{store.AuditEntry{Entity: "basket", Before: `{"Name":"notes"}`, After: `{"Name":"notes"}`}, "notes"},
+		{store.AuditEntry{Entity: "basket", Before: `{"Name":"notes"}`, After: `{"Name":"books"}`}, "notes -> books"},
+		{store.AuditEntry{Entity: "basket", Before: `{"Name":"notes","DeletedAt":"2025-03-03T14:05:00Z"}`, After: `{"Name":"notes"}`}, "notes (in the trash) -> notes"},
+		{store.AuditEntry{Entity: "pin", After: `{"Content":"a\nb","Basket":"notes","Position":2}`}, "notes: a b (position 2)"},
+		{store.AuditEntry{Entity: "deadline", After: `{"Title":"essay","DueAt":"2025-03-03T14:05:00Z"}`}, "essay (Mon, Mar 3 at 2:05 PM), reminders: none, only when it expires"},
+		{
+			store.AuditEntry{
+				Entity: "deadline",
+				Before: `{"Title":"essay","DueAt":"2025-03-03T14:05:00Z","Reminders":[3600000000000]}`,
+				After:  `{"Title":"essay","DueAt":"2025-03-03T14:05:00Z","Reminders":[3600000000000,86400000000000],"Recurrence":{"Days":7}}`,
+			},
+			"essay (Mon, Mar 3 at 2:05 PM), reminders: 1h before -> essay (Mon, Mar 3 at 2:05 PM), repeats weekly, reminders: 1d, 1h before",
+		},
+		{
+			store.AuditEntry{Entity: "deadline", After: `{"Title":"` + strings.Repeat("a", auditSnippet+1) + `","DueAt":"2025-03-03T14:05:00Z","Reminders":[3600000000000]}`},
+			strings.Repeat("a", auditSnippet-3) + "... (Mon, Mar 3 at 2:05 PM), reminders: 1h before",
+		},
+		{store.AuditEntry{Entity: "role", Before: `{"User":"2","Role":"member"}`, After: `{"User":"2","Role":"admin"}`}, "member -> admin"},
+		{store.AuditEntry{Entity: "something", After: `not json`}, "not json"},
+		{store.AuditEntry{Entity: "role"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := describeChange(tt.e, time.UTC); got != tt.want {
+			t.Errorf("describeChange(%+v) = %q, want %q", tt.e, got, tt.want)
+		}
+	}
+}
+
+func TestShorten(t *testing.T) {
+	long := strings.Repeat("é", auditSnippet+1)
+
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"  two\n  lines ", "two lines"},
+		{long[:2*auditSnippet], long[:2*auditSnippet]},
+		{long, long[:2*(auditSnippet-3)] + "..."},
+	}
+
+	for _, tt := range tests {
+		if got := shorten(tt.in); got != tt.want {
+			t.Errorf("shorten(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// Deleting a basket with more pins than this needs confirming.
+const confirmDeleteOver = 10
+
+func basketAdd(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 || strings.TrimSpace(args[0].Text) == "" {
+		return "", errors.New("missing basket name")
+	}
+	name := args[0].Text
+
+	err := audited(ctx, req, s, "basket", func(s store.Store) (auditChange, error) {
+		if err := s.AddBasket(ctx, req.Chat, name); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strings.ToLower(name), after: store.Basket{Name: strings.ToLower(name)}}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "basket created successfully", nil
+}
+
+func basketGet(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	baskets, err := s.ListBaskets(ctx, req.Chat)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(baskets) == 0 {
+		return "there are no baskets", nil
+	}
+
+	var out strings.Builder
+	out.WriteString("list of baskets:\n")
+	for _, b := range baskets {
+		fmt.Fprintf(&out, "- %s (%s)", b.Name, pinCount(b.Pins))
+		if b.Description != "" {
+			out.WriteString(": " + b.Description)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
+
+func basketDel(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing basket name")
+	}
+	name := strings.ToLower(args[0].Text)
+	confirmed := len(args) > 1 && args[1].Text == "confirm" && !args[1].Quoted
+
+	baskets, err := s.ListBaskets(ctx, req.Chat)
+	if err != nil {
+		return "", err
+	}
+
+	if b, ok := findBasket(baskets, name); ok && b.Pins > confirmDeleteOver && !confirmed {
+		return fmt.Sprintf("%s has %d pins, send %sb del %s confirm to delete it", name, b.Pins, req.prefix, quote(name)), nil
+	}
+
+	err = audited(ctx, req, s, "basket", func(s store.Store) (auditChange, error) {
+		before, err := lookupBasket(ctx, s.ListBaskets, req.Chat, name)
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := s.DeleteBasket(ctx, req.Chat, name); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: name, before: before}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("basket moved to the trash, %sb restore %s brings it back", req.prefix, quote(name)), nil
+}
+
+func basketTrash(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	baskets, err := s.ListTrash(ctx, req.Chat)
+	if err != nil {
+		return "", err
+	}
+
+	if len(baskets) == 0 {
+		return "the trash is empty", nil
+	}
+
+	var out strings.Builder
+	out.WriteString("deleted baskets:\n")
+	for _, b := range baskets {
+		fmt.Fprintf(&out, "- %s (%s), deleted %s\n", b.Name, pinCount(b.Pins), b.DeletedAt.In(s.Timezone()).Format(store.DisplayFormat))
+	}
+
+	return out.String(), nil
+}
+
+func basketRestore(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing basket name")
+	}
+	name := args[0].Text
+
+	err := audited(ctx, req, s, "basket", func(s store.Store) (auditChange, error) {
+		before, err := lookupBasket(ctx, s.ListTrash, req.Chat, strings.ToLower(name))
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := s.RestoreBasket(ctx, req.Chat, name); err != nil {
+			return auditChange{}, err
+		}
+		return basketChange(ctx, s, req.Chat, strings.ToLower(name), before)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "basket " + strings.ToLower(name) + " restored", nil
+}
+
+func basketRename(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing basket name")
+	}
+	if len(args) < 2 || strings.TrimSpace(args[1].Text) == "" {
+		return "", errors.New("missing new basket name")
+	}
+	name, newName := args[0].Text, args[1].Text
+
+	err := audited(ctx, req, s, "basket", func(s store.Store) (auditChange, error) {
+		before, err := lookupBasket(ctx, s.ListBaskets, req.Chat, strings.ToLower(name))
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := s.RenameBasket(ctx, req.Chat, name, newName); err != nil {
+			return auditChange{}, err
+		}
+		return basketChange(ctx, s, req.Chat, strings.ToLower(newName), before)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("basket %s renamed to %s", name, strings.ToLower(newName)), nil
+}
+
+func basketDesc(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing basket name")
+	}
+	name := args[0].Text
+	desc := args.Rest(1)
+
+	err := audited(ctx, req, s, "basket", func(s store.Store) (auditChange, error) {
+		before, err := lookupBasket(ctx, s.ListBaskets, req.Chat, strings.ToLower(name))
+		if err != nil {
+			return auditChange{}, err
+		}
+		if err := s.SetBasketDescription(ctx, req.Chat, name, desc); err != nil {
+			return auditChange{}, err
+		}
+		return basketChange(ctx, s, req.Chat, strings.ToLower(name), before)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if desc == "" {
+		return "description of " + name + " cleared", nil
+	}
+	return "description of " + name + " updated", nil
+}
+
+// findBasket returns the basket called name in baskets.
+func findBasket(baskets []store.Basket, name string) (store.Basket, bool) {
+	i := slices.IndexFunc(baskets, func(b store.Basket) bool { return b.Name == name })
+	if i < 0 {
+		return store.Basket{}, false
+	}
+	return baskets[i], true
+}
+
+// lookupBasket returns the basket called name among those list returns for
+// group, or nil if there is none.
+func lookupBasket(ctx context.Context, list func(ctx context.Context, group string) ([]store.Basket, error), group, name string) (any, error) {
+	baskets, err := list(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := findBasket(baskets, name); ok {
+		return b, nil
+	}
+	return nil, nil
+}
+
+// basketChange returns the change to the basket now called name, which was
+// before. The basket is looked up again for its new state.
+func basketChange(ctx context.Context, s store.Store, group, name string, before any) (auditChange, error) {
+	after, err := lookupBasket(ctx, s.ListBaskets, group, name)
+	if err != nil {
+		return auditChange{}, err
+	}
+	return auditChange{target: name, before: before, after: after}, nil
+}
+
+func pinCount(n int) string {
+	if n == 1 {
+		return "1 pin"
+	}
+	return fmt.Sprintf("%d pins", n)
+}
@@ -0,0 +1,366 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// RunFunc runs a command with the words after its name, or after its
+// subcommand if it has one.
+type RunFunc func(ctx context.Context, req Request, args Args, s store.Store) (Response, error)
+
+// Command is a top level command such as .p. Help and usage are generated
+// from it, so everything a command accepts should be described here.
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string // shown by .h
+	// Usage, Role and Run are for sending the command without a
+	// subcommand. Commands without Run show their usage instead.
+	Usage       []Usage
+	Role        store.Role
+	Run         RunFunc
+	Subcommands []Subcommand
+	Notes       string // shown after the usage
+}
+
+// Subcommand is an action of a command, such as add in .p add.
+type Subcommand struct {
+	Name    string
+	Aliases []string
+	Usage   []Usage    // ways to call it, at least one
+	Role    store.Role // least role needed, empty if open to everyone
+	Run     RunFunc
+}
+
+// Usage is one way to call a command.
+type Usage struct {
+	// Args is the argument spec, such as "[id] time [date]". Arguments are
+	// in brackets, option arguments follow their name as in "in:[basket]",
+	// and other words are typed as they are.
+	Args        string
+	Description string
+}
+
+// text adapts a handler that only replies with text.
+func text(f func(ctx context.Context, req Request, args Args, s store.Store) (string, error)) RunFunc {
+	return func(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+		out, err := f(ctx, req, args, s)
+		return Response{Text: out}, err
+	}
+}
+
+// commands is every command, in the order .h lists them. It is filled in
+// init because .h itself reads it.
+var commands []Command
+
+func init() {
+	commands = []Command{
+		{
+			Name:        "d",
+			Aliases:     []string{"deadline", "deadlines"},
+			Description: "Manage deadlines",
+			Subcommands: []Subcommand{
+				{
+					Name:    "get",
+					Aliases: []string{"list"},
+					Usage: []Usage{
+						{"", "list all deadlines"},
+						{"who", "also show who added and last edited each"},
+						{"by:[@member]", "list the deadlines someone added"},
+					},
+					Run: text(deadlineGet),
+				},
+				{
+					Name:    "del",
+					Aliases: []string{"rm"},
+					Usage:   []Usage{{"[id]", "remove a deadline"}},
+					Role:    store.RoleAdmin,
+					Run:     text(deadlineDel),
+				},
+				{
+					Name:  "add",
+					Usage: []Usage{{"[date] [title]", "add a new deadline"}},
+					Run:   text(deadlineAdd),
+				},
+				{
+					Name: "edit",
+					Usage: []Usage{
+						{"[id] time [date]", "change when a deadline is due"},
+						{"[id] title [title]", "rename a deadline"},
+					},
+					Role: store.RoleModerator,
+					Run:  text(deadlineEdit),
+				},
+				{
+					Name:  "remind",
+					Usage: []Usage{{"[id] [offsets]", "set when to be reminded, e.g. 7d,3d,1d"}},
+					Role:  store.RoleModerator,
+					Run:   text(deadlineRemind),
+				},
+			},
+			Notes: `Dates can be written like tomorrow 23:59, fri 5pm, in 3 days, next monday, 25/12 10:00, dec 25 or 2025-12-25 10:00
+
+Options for add:
+repeat:[daily|weekly|monthly|3d|2w]   repeat after expiry
+until:[date]   stop repeating after this date
+remind:[offsets]   remind this long before, e.g. 7d,3d,1h or none`,
+		},
+		{
+			Name:        "b",
+			Aliases:     []string{"basket", "baskets"},
+			Description: "Manage baskets",
+			Subcommands: []Subcommand{
+				{
+					Name:    "get",
+					Aliases: []string{"list"},
+					Usage:   []Usage{{"", "list all baskets"}},
+					Run:     text(basketGet),
+				},
+				{
+					Name:  "add",
+					Usage: []Usage{{"[name]", "add a new basket"}},
+					Run:   text(basketAdd),
+				},
+				{
+					Name:    "del",
+					Aliases: []string{"rm"},
+					Usage:   []Usage{{"[name]", "move a basket and its pins to the trash"}},
+					Role:    store.RoleAdmin,
+					Run:     text(basketDel),
+				},
+				{
+					Name:  "trash",
+					Usage: []Usage{{"", "list deleted baskets"}},
+					Run:   text(basketTrash),
+				},
+				{
+					Name:  "restore",
+					Usage: []Usage{{"[name]", "bring a basket back from the trash"}},
+					Role:  store.RoleModerator,
+					Run:   text(basketRestore),
+				},
+				{
+					Name:  "rename",
+					Usage: []Usage{{"[name] [new name]", "rename a basket, keeping its pins"}},
+					Role:  store.RoleModerator,
+					Run:   text(basketRename),
+				},
+				{
+					Name:  "desc",
+					Usage: []Usage{{"[name] [text]", "describe what goes in a basket, or clear it without text"}},
+					Role:  store.RoleModerator,
+					Run:   text(basketDesc),
+				},
+			},
+		},
+		{
+			Name:        "p",
+			Aliases:     []string{"pin", "pins"},
+			Description: "Manage pins",
+			Subcommands: []Subcommand{
+				{
+					Name:    "get",
+					Aliases: []string{"list"},
+					Usage: []Usage{
+						{"[basket]", "list all pins in a basket"},
+						{"[basket] who", "also show who added and last edited each"},
+						{"[basket] by:[@member]", "list the pins someone added"},
+					},
+					Run: pinGet,
+				},
+				{
+					Name: "add",
+					Usage: []Usage{
+						{"[basket] [content]", "add a new pin"},
+						{"[basket]", "pin the message or file you are replying to"},
+					},
+					Run: pinAdd,
+				},
+				{
+					Name:    "del",
+					Aliases: []string{"rm"},
+					Usage:   []Usage{{"[id]", "remove a pin from a basket"}},
+					Role:    store.RoleAdmin,
+					Run:     pinDel,
+				},
+				{
+					Name:  "edit",
+					Usage: []Usage{{"[id] [content]", "replace the content of a pin"}},
+					Role:  store.RoleModerator,
+					Run:   pinEdit,
+				},
+				{
+					Name:  "move",
+					Usage: []Usage{{"[id] [basket]", "move a pin to another basket"}},
+					Role:  store.RoleModerator,
+					Run:   pinMove,
+				},
+				{
+					Name:  "pos",
+					Usage: []Usage{{"[id] [n]", "make a pin the nth of its basket"}},
+					Role:  store.RoleModerator,
+					Run:   pinPos,
+				},
+				{
+					Name:  "show",
+					Usage: []Usage{{"[id]", "show a pin and the message it was pinned from"}},
+					Run:   pinShow,
+				},
+				{
+					Name:  "send",
+					Usage: []Usage{{"[id]", "send the file of a pin"}},
+					Run:   pinSend,
+				},
+				{
+					Name: "find",
+					Usage: []Usage{
+						{"[words]", "search pins in all baskets"},
+						{"in:[basket] [words]", "search pins in one basket"},
+					},
+					Run: pinFind,
+				},
+			},
+		},
+		{
+			Name:        "role",
+			Aliases:     []string{"roles"},
+			Description: "Manage who can run which commands",
+			Usage:       []Usage{{"", "show your role"}},
+			Run:         text(roleShow),
+			Subcommands: []Subcommand{
+				{
+					Name:  "list",
+					Usage: []Usage{{"", "list roles given to members"}},
+					Run:   text(roleList),
+				},
+				{
+					Name:  "set",
+					Usage: []Usage{{"[@member] [role]", "make someone an admin, moderator or member"}},
+					Role:  store.RoleAdmin,
+					Run:   text(roleSet),
+				},
+				{
+					Name:  "reset",
+					Usage: []Usage{{"[@member]", "give someone back their role from the group"}},
+					Role:  store.RoleAdmin,
+					Run:   text(roleReset),
+				},
+			},
+			Notes: `Reply to someone's message to leave out @member.
+
+Group admins are admins and everyone else is a member, unless given another role.`,
+		},
+		{
+			Name:        "audit",
+			Description: "Review recent changes",
+			Usage:       []Usage{{"[n]", "list the last n changes to deadlines, baskets, pins and roles, 10 by default"}},
+			Role:        store.RoleAdmin,
+			Run:         auditCommand,
+		},
+		{
+			Name:        "t",
+			Aliases:     []string{"toss"},
+			Description: "Random coin toss",
+			Usage:       []Usage{{"", "toss a coin"}},
+			Run:         text(toss),
+		},
+		{
+			Name:        "h",
+			Aliases:     []string{"help"},
+			Description: "Print this message",
+			Usage: []Usage{
+				{"", "list all commands"},
+				{"[command]", "show how to use a command"},
+			},
+			Run: helpCommand,
+		},
+	}
+}
+
+// findCommand looks a command up by its name or one of its aliases.
+func findCommand(name string) *Command {
+	name = strings.ToLower(name)
+	for i, c := range commands {
+		if c.Name == name || slices.Contains(c.Aliases, name) {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// subcommand looks a subcommand of c up by its name or one of its aliases.
+func (c *Command) subcommand(name string) *Subcommand {
+	name = strings.ToLower(name)
+	for i, sub := range c.Subcommands {
+		if sub.Name == name || slices.Contains(sub.Aliases, name) {
+			return &c.Subcommands[i]
+		}
+	}
+	return nil
+}
+
+// help lists every command.
+func help(prefix string) string {
+	var out strings.Builder
+	out.WriteString("Available commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&out, "%s%s   %s\n", prefix, c.Name, c.Description)
+	}
+	fmt.Fprintf(&out, "\nType any command to see its usage, or %sh [command]", prefix)
+	fmt.Fprintf(&out, "\nPut arguments with spaces in quotes, e.g. %sb add \"reading list\"", prefix)
+	return out.String()
+}
+
+// usage lists every way to call c.
+func usage(prefix string, c *Command) string {
+	var out strings.Builder
+	out.WriteString("Usage:")
+
+	line := func(words []string, u Usage) {
+		out.WriteString("\n" + prefix + strings.Join(slices.DeleteFunc(words, func(w string) bool { return w == "" }), " "))
+		out.WriteString("   " + u.Description)
+	}
+
+	for _, u := range c.Usage {
+		line([]string{c.Name, u.Args}, u)
+	}
+	for _, sub := range c.Subcommands {
+		for _, u := range sub.Usage {
+			line([]string{c.Name, sub.Name, u.Args}, u)
+		}
+	}
+
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(&out, "\n\n%s%s can also be written as %s%s", prefix, c.Name, prefix, strings.Join(c.Aliases, ", "+prefix))
+	}
+	if c.Notes != "" {
+		out.WriteString("\n\n" + c.Notes)
+	}
+
+	return out.String()
+}
+
+func helpCommand(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	if len(args) == 0 {
+		return Response{Text: help(req.prefix)}, nil
+	}
+
+	c := findCommand(strings.TrimPrefix(args[0].Text, req.prefix))
+	if c == nil {
+		return Response{}, fmt.Errorf("no command called %s", args[0].Text)
+	}
+	return Response{Text: usage(req.prefix, c)}, nil
+}
+
+func toss(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if rand.IntN(2) == 1 {
+		return "heads", nil
+	}
+	return "tails", nil
+}
@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// argSpec matches an argument spec: bracketed arguments, options such as
+// in:[basket] and plain words.
+var argSpec = regexp.MustCompile(`^(\[[^\[\]]+\]|[a-z]+:\[[^\[\]]+\]|[a-z]+)( (\[[^\[\]]+\]|[a-z]+:\[[^\[\]]+\]|[a-z]+))*$`)
+
+func TestCommandNames(t *testing.T) {
+	seen := map[string]string{}
+	for _, c := range commands {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if name == "" || name != strings.ToLower(strings.TrimSpace(name)) {
+				t.Errorf("command %q: bad name or alias %q", c.Name, name)
+			}
+			if other, ok := seen[name]; ok {
+				t.Errorf("%q is used by both %q and %q", name, other, c.Name)
+			}
+			seen[name] = c.Name
+		}
+
+		subs := map[string]string{}
+		for _, sub := range c.Subcommands {
+			for _, name := range append([]string{sub.Name}, sub.Aliases...) {
+				if name == "" || name != strings.ToLower(strings.TrimSpace(name)) {
+					t.Errorf("%s %s: bad name or alias %q", c.Name, sub.Name, name)
+				}
+				if other, ok := subs[name]; ok {
+					t.Errorf("%s: %q is used by both %q and %q", c.Name, name, other, sub.Name)
+				}
+				subs[name] = sub.Name
+			}
+		}
+	}
+}
+
+func TestCommandMetadata(t *testing.T) {
+	checkUsage := func(name string, usage []Usage) {
+		for _, u := range usage {
+			if u.Description == "" {
+				t.Errorf("%s %s: missing description", name, u.Args)
+			}
+			if u.Args != "" && !argSpec.MatchString(u.Args) {
+				t.Errorf("%s: bad argument spec %q", name, u.Args)
+			}
+		}
+	}
+
+	for _, c := range commands {
+		if c.Description == "" {
+			t.Errorf("%s: missing description", c.Name)
+		}
+		if c.Run == nil && len(c.Subcommands) == 0 {
+			t.Errorf("%s: has nothing to run", c.Name)
+		}
+		if (c.Run == nil) != (len(c.Usage) == 0) {
+			t.Errorf("%s: Run and Usage must be given together", c.Name)
+		}
+		checkUsage(c.Name, c.Usage)
+
+		for _, sub := range c.Subcommands {
+			name := c.Name + " " + sub.Name
+			if sub.Run == nil {
+				t.Errorf("%s: missing Run", name)
+			}
+			if len(sub.Usage) == 0 {
+				t.Errorf("%s: missing usage", name)
+			}
+			if sub.Role != "" {
+				if _, err := store.ParseRole(string(sub.Role)); err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+			checkUsage(name, sub.Usage)
+		}
+	}
+}
+
+func TestCommandRoles(t *testing.T) {
+	tests := []struct {
+		command string
+		want    store.Role
+	}{
+		{"d del", store.RoleAdmin},
+		{"b del", store.RoleAdmin},
+		{"p del", store.RoleAdmin},
+		{"role set", store.RoleAdmin},
+		{"role reset", store.RoleAdmin},
+		{"audit", store.RoleAdmin},
+		{"d edit", store.RoleModerator},
+		{"d remind", store.RoleModerator},
+		{"b rename", store.RoleModerator},
+		{"b desc", store.RoleModerator},
+		{"b restore", store.RoleModerator},
+		{"p edit", store.RoleModerator},
+		{"p move", store.RoleModerator},
+		{"p pos", store.RoleModerator},
+		{"d add", ""},
+		{"p add", ""},
+		{"role list", ""},
+	}
+
+	for _, tt := range tests {
+		name, subName, hasSub := strings.Cut(tt.command, " ")
+		c := findCommand(name)
+		if c == nil {
+			t.Fatalf("no command %q", name)
+		}
+		role := c.Role
+		if hasSub {
+			sub := c.subcommand(subName)
+			if sub == nil {
+				t.Fatalf("no subcommand %q", tt.command)
+			}
+			role = sub.Role
+		}
+		if role != tt.want {
+			t.Errorf("%s needs %q, want %q", tt.command, role, tt.want)
+		}
+	}
+}
+
+func TestHelpListsEverything(t *testing.T) {
+	out := help("!")
+	for _, c := range commands {
+		if !strings.Contains(out, "!"+c.Name+" ") {
+			t.Errorf("help is missing !%s:\n%s", c.Name, out)
+		}
+
+		u := usage("!", &c)
+		for _, sub := range c.Subcommands {
+			if !strings.Contains(u, "!"+c.Name+" "+sub.Name) {
+				t.Errorf("usage of %s is missing %s:\n%s", c.Name, sub.Name, u)
+			}
+		}
+	}
+}
+
+func TestHandleRoutes(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+	if err := s.AddBasket(ctx, "g", "notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{".h", help(".")},
+		{".help", help(".")},
+		{".h p", usage(".", findCommand("p"))},
+		{".h nope", "no command called nope"},
+		{".nope", help(".")},
+		{".b", usage(".", findCommand("b"))},
+		{".b nope", usage(".", findCommand("b"))},
+		{".basket list", "list of baskets:\n- notes (0 pins)\n"},
+		{".B GET", "list of baskets:\n- notes (0 pins)\n"},
+		{".b rm notes", "only admins can use this command"},
+		{".audit", "only admins can use this command"},
+		{".role", "your role is member"},
+		{".role nope", usage(".", findCommand("role"))},
+		{"hello", ""},
+		{`.b add "reading list"`, "basket created successfully"},
+		{".p add \"reading list\" first line\n  second line", "pin #1 added to reading list"},
+		{`.p get "reading list"`, "reading list pins:\n1. first line\n  second line\n"},
+		{`.p get "reading list" by:@1`, "reading list pins:\n1. first line\n  second line\n"},
+		{`.p get "reading list" by:@2`, "no pins in basket reading list added by @2"},
+		{`.p get "reading list" everything`, `could not read "everything", use who or by:@member`},
+		{`.p find in:"reading list" second`, "pins matching \"second\":\n1. [reading list] first line\n  *second* line\n"},
+	}
+
+	for _, tt := range tests {
+		req := Request{Text: tt.text, Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net"}}
+		if got := Handle(ctx, req, ".", s).Text; got != tt.want {
+			t.Errorf("Handle(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRoleTarget(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{".role set @2 moderator", "@2 is now a moderator"},
+		{".role set @2:5@s.whatsapp.net admin", "@2 is now an admin"},
+		{".role set @ admin", "mention a member or reply to one of their messages"},
+		{".role set admin", "mention a member or reply to one of their messages"},
+		{".role reset @", "mention a member or reply to one of their messages"},
+		{".role list", "roles:\n- @2 admin\n"},
+	}
+
+	for _, tt := range tests {
+		req := Request{Text: tt.text, Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net", GroupAdmin: isAdmin}}
+		if got := Handle(ctx, req, ".", s).Text; got != tt.want {
+			t.Errorf("Handle(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDeadlineEditNeedsTitle(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+	d, err := s.AddDeadline(ctx, "g", "essay", time.Now().Add(48*time.Hour), nil, store.Recurrence{}, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{`.d edit 1 title ""`, `.d edit 1 title "  "`} {
+		req := Request{Text: text, Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net", GroupAdmin: isAdmin}}
+		if got := Handle(ctx, req, ".", s).Text; got != "missing new title" {
+			t.Errorf("Handle(%q) = %q, want missing new title", text, got)
+		}
+	}
+
+	if got, _ := s.GetDeadline(ctx, "g", d.ID); got.Title != "essay" || got.UpdatedBy != "" {
+		t.Errorf("deadline = %+v, want it untouched", got)
+	}
+	if entries, _ := s.ListAuditEntries(ctx, "g", 10); len(entries) != 0 {
+		t.Errorf("audit log = %+v, want nothing recorded", entries)
+	}
+}
+
+func TestPinAddChecksBasketFirst(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemStore(time.UTC, nil)
+	if err := s.AddBasket(ctx, "g", "notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := 0
+	file := &Attachment{Kind: "document", Name: "slides.pdf", Save: func(ctx context.Context) (string, error) {
+		saved++
+		return "ab12", nil
+	}}
+
+	tests := []struct {
+		text      string
+		want      string
+		wantSaved int
+	}{
+		{".p add typo", "basket does not exist", 0},
+		{".p add notes", "pin #1 added to notes", 1},
+	}
+
+	for _, tt := range tests {
+		req := Request{Text: tt.text, Chat: "g", Sender: Sender{ID: "1@s.whatsapp.net"}, Quoted: &Quoted{ID: "q", Attachment: file}}
+		if got := Handle(ctx, req, ".", s).Text; got != tt.want || saved != tt.wantSaved {
+			t.Errorf("Handle(%q) = %q after %d saves, want %q after %d", tt.text, got, saved, tt.want, tt.wantSaved)
+		}
+	}
+}
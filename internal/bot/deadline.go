@@ -0,0 +1,382 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/dateparse"
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+func deadlineGet(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	opts, err := parseListOptions(args)
+	if err != nil {
+		return "", err
+	}
+
+	deadlines, err := s.ListDeadlines(ctx, req.Chat)
+
+	if err != nil {
+		return "", err
+	}
+
+	deadlines = slices.DeleteFunc(deadlines, func(d store.Deadline) bool { return !opts.keep(d.Attribution) })
+
+	if len(deadlines) == 0 {
+		if opts.by != "" {
+			return "no upcoming deadlines added by " + mention(opts.by), nil
+		}
+		return "no upcoming deadlines", nil
+	}
+
+	tz := s.Timezone()
+	var out strings.Builder
+	out.WriteString("upcoming deadlines:\n")
+	for _, d := range deadlines {
+		localTime := d.DueAt.In(tz).Format(store.DisplayFormat)
+		fmt.Fprintf(&out, "%d. %s (%s)", d.ID, d.Title, localTime)
+		if d.Recurrence.Repeats() {
+			fmt.Fprintf(&out, " [repeats %s]", describeRecurrence(d.Recurrence, tz))
+		}
+		if who := describeAttribution(d.Attribution, tz); opts.who && who != "" {
+			out.WriteString("\n   " + who)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
+
+func deadlineAdd(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "missing date and title", nil
+	}
+
+	tz := s.Timezone()
+
+	dueAt, used, err := parseDueDate(args.Strings(), tz)
+	if err != nil {
+		return "", err
+	}
+
+	titleParts, rec, err := parseRecurrence(args[used:], tz)
+	if err != nil {
+		return "", err
+	}
+
+	titleParts, reminders, err := parseReminderOption(titleParts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(titleParts) == 0 {
+		return "missing title", nil
+	}
+
+	title := titleParts.Join()
+
+	var d store.Deadline
+	err = audited(ctx, req, s, "deadline", func(s store.Store) (auditChange, error) {
+		var err error
+		d, err = s.AddDeadline(ctx, req.Chat, title, dueAt, reminders, rec, userID(req.Sender.ID))
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strconv.Itoa(d.ID), after: d}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	displayTime := d.DueAt.In(tz).Format(store.DisplayFormat)
+
+	result := fmt.Sprintf(
+		"deadline #%d added: %s (%s)",
+		d.ID,
+		d.Title,
+		displayTime,
+	)
+	if d.Recurrence.Repeats() {
+		result += ", repeats " + describeRecurrence(d.Recurrence, tz)
+	}
+	result += "\nreminders: " + describeReminders(d.Reminders)
+	result += fmt.Sprintf(
+		"\nread %q as %s",
+		args[:used].Join(),
+		d.DueAt.In(tz).Format(ConfirmFormat),
+	)
+
+	return result, nil
+}
+
+func deadlineEdit(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing deadline id")
+	}
+
+	id, err := strconv.Atoi(args[0].Text)
+	if err != nil {
+		return "", errors.New("id must be an integer")
+	}
+
+	if len(args) < 2 {
+		return "", errors.New("missing what to edit: time or title")
+	}
+
+	tz := s.Timezone()
+	var (
+		title string
+		dueAt time.Time
+	)
+
+	switch args[1].Text {
+	case "time":
+		if len(args) < 3 {
+			return "", errors.New("missing new date")
+		}
+
+		var used int
+		dueAt, used, err = parseDueDate(args[2:].Strings(), tz)
+		if err != nil {
+			return "", err
+		}
+
+		if 2+used < len(args) {
+			return "", fmt.Errorf("could not read %q as part of the date", args[2+used:].Join())
+		}
+
+	case "title":
+		if len(args) < 3 {
+			return "", errors.New("missing new title")
+		}
+		title = args.Rest(2)
+		if strings.TrimSpace(title) == "" {
+			return "", errors.New("missing new title")
+		}
+
+	default:
+		return "", errors.New("can only edit time or title")
+	}
+
+	var d store.Deadline
+	err = audited(ctx, req, s, "deadline", func(s store.Store) (auditChange, error) {
+		before, err := s.GetDeadline(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		// Keep whatever is not being edited.
+		newTitle, newDueAt := title, dueAt
+		if newTitle == "" {
+			newTitle = before.Title
+		}
+		if newDueAt.IsZero() {
+			newDueAt = before.DueAt
+		}
+
+		d, err = s.UpdateDeadline(ctx, req.Chat, id, newTitle, newDueAt, userID(req.Sender.ID))
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strconv.Itoa(id), before: before, after: d}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(
+		"deadline #%d updated: %s (%s)",
+		d.ID,
+		d.Title,
+		d.DueAt.In(tz).Format(ConfirmFormat),
+	), nil
+}
+
+func deadlineRemind(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing deadline id")
+	}
+
+	id, err := strconv.Atoi(args[0].Text)
+	if err != nil {
+		return "", errors.New("id must be an integer")
+	}
+
+	if len(args) < 2 {
+		d, err := s.GetDeadline(ctx, req.Chat, id)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deadline #%d reminders: %s", d.ID, describeReminders(d.Reminders)), nil
+	}
+
+	reminders, err := store.ParseReminders(strings.Join(args[1:].Strings(), ""))
+	if err != nil {
+		return "", err
+	}
+
+	var d store.Deadline
+	err = audited(ctx, req, s, "deadline", func(s store.Store) (auditChange, error) {
+		before, err := s.GetDeadline(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		d, err = s.SetReminders(ctx, req.Chat, id, reminders, userID(req.Sender.ID))
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strconv.Itoa(id), before: before, after: d}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("deadline #%d reminders: %s", d.ID, describeReminders(d.Reminders)), nil
+}
+
+func deadlineDel(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing deadline id")
+	}
+	idStr := args[0].Text
+	id, err := strconv.Atoi(idStr)
+
+	if err != nil {
+		return "", errors.New("id must be an integer")
+	}
+
+	err = audited(ctx, req, s, "deadline", func(s store.Store) (auditChange, error) {
+		before, err := s.GetDeadline(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.DeleteDeadline(ctx, req.Chat, id); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: idStr, before: before}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("deadline #%d deleted successfully", id), nil
+}
+
+// ConfirmFormat spells out a parsed date in full so people can spot a
+// misread one.
+const ConfirmFormat = "Monday, January 2 2006 at 3:04 PM"
+
+// parseDueDate reads a due date from the start of words and returns it with
+// the number of words it used. The date must be in the future.
+func parseDueDate(words []string, tz *time.Location) (time.Time, int, error) {
+	now := time.Now()
+
+	dueAt, used, err := dateparse.Parse(words, now, tz)
+	if errors.Is(err, dateparse.ErrNoDate) {
+		return time.Time{}, 0, errors.New(
+			"could not read the date. Try tomorrow 23:59, fri 5pm, in 3 days, next monday, 25/12 10:00 or 2025-12-25 10:00",
+		)
+	}
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	if !dueAt.After(now) {
+		return time.Time{}, 0, fmt.Errorf("%s is in the past", dueAt.In(tz).Format(ConfirmFormat))
+	}
+
+	return dueAt.UTC(), used, nil
+}
+
+func describeReminders(reminders []time.Duration) string {
+	if len(reminders) == 0 {
+		return "none, only when it expires"
+	}
+
+	// Longest first, in the order they will be sent.
+	parts := strings.Split(store.FormatReminders(reminders), ",")
+	slices.Reverse(parts)
+
+	return strings.Join(parts, ", ") + " before"
+}
+
+// parseReminderOption pulls the remind: option out of the words of a deadline
+// title. The returned schedule is nil if the option is absent.
+func parseReminderOption(words Args) (Args, []time.Duration, error) {
+	var (
+		rest      Args
+		reminders []time.Duration
+	)
+
+	for _, w := range words {
+		if v, ok := w.Option("remind"); ok {
+			r, err := store.ParseReminders(v)
+			if err != nil {
+				return nil, nil, err
+			}
+			reminders = r
+			continue
+		}
+
+		rest = append(rest, w)
+	}
+
+	return rest, reminders, nil
+}
+
+func describeRecurrence(rec store.Recurrence, tz *time.Location) string {
+	if rec.Until.IsZero() {
+		return rec.String()
+	}
+	return rec.String() + " until " + rec.Until.In(tz).Format("Jan 2, 2006")
+}
+
+// parseRecurrence pulls the repeat: and until: options out of the words of a
+// deadline title and returns the remaining words.
+func parseRecurrence(words Args, tz *time.Location) (Args, store.Recurrence, error) {
+	var (
+		rest  Args
+		rec   store.Recurrence
+		until time.Time
+	)
+
+	for _, w := range words {
+		if v, ok := w.Option("repeat"); ok {
+			r, err := store.ParseRecurrence(v)
+			if err != nil {
+				return nil, store.Recurrence{}, err
+			}
+			rec.Days, rec.Months = r.Days, r.Months
+			continue
+		}
+
+		if v, ok := w.Option("until"); ok {
+			day, used, err := dateparse.Parse([]string{v}, time.Now(), tz)
+			if err != nil || used != 1 {
+				return nil, store.Recurrence{}, errors.New("invalid until date. Use e.g. until:25/12 or until:2025-12-25")
+			}
+			// Occurrences anywhere on the end date still count.
+			y, m, dd := day.In(tz).Date()
+			until = time.Date(y, m, dd+1, 0, 0, 0, 0, tz).Add(-time.Second)
+			continue
+		}
+
+		rest = append(rest, w)
+	}
+
+	if !until.IsZero() {
+		if !rec.Repeats() {
+			return nil, store.Recurrence{}, errors.New("until: needs a repeat: rule")
+		}
+		rec.Until = until.UTC()
+	}
+
+	return rest, rec, nil
+}
@@ -0,0 +1,374 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// At most this many pins are shown by .p find.
+const findLimit = 10
+
+// pinID reads the pin ID at the start of args.
+func pinID(args Args) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("missing pin id")
+	}
+
+	id, err := strconv.Atoi(args[0].Text)
+	if err != nil {
+		return 0, errors.New("id must be an integer")
+	}
+	return id, nil
+}
+
+func pinGet(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	if len(args) == 0 {
+		return Response{}, errors.New("missing basket name")
+	}
+
+	name := args[0].Text
+	opts, err := parseListOptions(args[1:])
+	if err != nil {
+		return Response{}, err
+	}
+
+	pins, err := s.ListPins(ctx, req.Chat, name)
+
+	if err != nil {
+		return Response{}, err
+	}
+
+	pins = slices.DeleteFunc(pins, func(p store.Pin) bool { return !opts.keep(p.Attribution) })
+
+	if len(pins) == 0 {
+		if opts.by != "" {
+			return Response{Text: fmt.Sprintf("no pins in basket %s added by %s", name, mention(opts.by))}, nil
+		}
+		return Response{Text: "no pins in basket " + name}, nil
+	}
+
+	tz := s.Timezone()
+	var out strings.Builder
+	out.WriteString(name + " pins:\n")
+	for _, p := range pins {
+		fmt.Fprintf(&out, "%d. %s", p.ID, pinText(p))
+		if !p.Source.IsZero() {
+			fmt.Fprintf(&out, " (from %s)", mention(p.Source.Sender))
+		}
+		if who := describeAttribution(p.Attribution, tz); opts.who && who != "" {
+			out.WriteString("\n   " + who)
+		}
+		out.WriteString("\n")
+	}
+
+	return Response{Text: out.String()}, nil
+}
+
+func pinAdd(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	if len(args) == 0 {
+		return Response{}, errors.New("missing basket name")
+	}
+
+	name := args[0].Text
+	pin := store.Pin{
+		Content:     args.Rest(1),
+		Attribution: store.Attribution{CreatedBy: userID(req.Sender.ID)},
+	}
+
+	// Check the basket before downloading a file into it.
+	baskets, err := s.ListBaskets(ctx, req.Chat)
+	if err != nil {
+		return Response{}, err
+	}
+	if _, ok := findBasket(baskets, strings.ToLower(name)); !ok {
+		return Response{}, store.ErrBasketNotFound
+	}
+
+	// Replying to a message pins it, or links the given content to it.
+	if req.Quoted != nil {
+		if pin.Content == "" {
+			pin.Content = req.Quoted.Text
+		}
+		pin.Source = store.PinSource{
+			MessageID: req.Quoted.ID,
+			Sender:    req.Quoted.Sender,
+			SentAt:    req.Quoted.SentAt,
+		}
+
+		if a := req.Quoted.Attachment; a != nil {
+			sum, err := a.Save(ctx)
+			if err != nil {
+				return Response{}, err
+			}
+			pin.Media = store.PinMedia{SHA256: sum, Kind: a.Kind, MIME: a.MIME, Name: a.Name}
+		}
+	}
+
+	if pin.Content == "" && pin.Media.IsZero() {
+		if req.Quoted != nil {
+			return Response{}, errors.New("the quoted message has no text to pin")
+		}
+		return Response{}, errors.New("missing pin content, or reply to a message to pin it")
+	}
+
+	var added store.Pin
+	err = audited(ctx, req, s, "pin", func(s store.Store) (auditChange, error) {
+		var err error
+		added, err = s.AddPin(ctx, req.Chat, name, pin)
+		if err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strconv.Itoa(added.ID), after: pinSnapshot{Pin: added}}, nil
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Text: fmt.Sprintf("pin #%d added to %s", added.ID, name)}, nil
+}
+
+func pinShow(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+
+	pin, err := s.GetPin(ctx, req.Chat, id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	text := fmt.Sprintf("pin #%d: %s", pin.ID, pinText(pin))
+	if who := describeAttribution(pin.Attribution, s.Timezone()); who != "" {
+		text += "\n" + who
+	}
+	if !pin.Media.IsZero() {
+		text += fmt.Sprintf("\nuse %sp send %d to get the file", req.prefix, pin.ID)
+	}
+	if pin.Source.IsZero() {
+		return Response{Text: text}, nil
+	}
+
+	// Quote the original message, so tapping the reply jumps to it.
+	return Response{
+		Text: text + "\n" + describeSource(pin.Source, s.Timezone()),
+		ReplyTo: &Quoted{
+			ID:     pin.Source.MessageID,
+			Sender: pin.Source.Sender,
+			Text:   pin.Content,
+		},
+	}, nil
+}
+
+func pinSend(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+
+	pin, err := s.GetPin(ctx, req.Chat, id)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if pin.Media.IsZero() {
+		return Response{}, fmt.Errorf("pin #%d has no file", pin.ID)
+	}
+
+	return Response{Text: pin.Content, Media: &pin.Media}, nil
+}
+
+func pinDel(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+
+	err = audited(ctx, req, s, "pin", func(s store.Store) (auditChange, error) {
+		before, err := s.GetPin(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.DeletePin(ctx, req.Chat, id); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: strconv.Itoa(id), before: pinSnapshot{Pin: before}}, nil
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Text: fmt.Sprintf("pin #%d successfully deleted", id)}, nil
+}
+
+func pinEdit(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+
+	content := args.Rest(1)
+	if content == "" {
+		return Response{}, errors.New("missing pin content")
+	}
+
+	err = audited(ctx, req, s, "pin", func(s store.Store) (auditChange, error) {
+		before, err := s.GetPin(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.EditPin(ctx, req.Chat, id, content, userID(req.Sender.ID)); err != nil {
+			return auditChange{}, err
+		}
+		return pinChange(ctx, s, req.Chat, pinSnapshot{Pin: before}, false)
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Text: fmt.Sprintf("pin #%d updated", id)}, nil
+}
+
+func pinMove(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(args) < 2 {
+		return Response{}, errors.New("missing basket name")
+	}
+
+	name := args[1].Text
+	err = audited(ctx, req, s, "pin", func(s store.Store) (auditChange, error) {
+		before, err := s.GetPin(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.MovePin(ctx, req.Chat, id, name, userID(req.Sender.ID)); err != nil {
+			return auditChange{}, err
+		}
+		return pinChange(ctx, s, req.Chat, pinSnapshot{Pin: before}, false)
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Text: fmt.Sprintf("pin #%d moved to %s", id, name)}, nil
+}
+
+func pinPos(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	id, err := pinID(args)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(args) < 2 {
+		return Response{}, errors.New("missing position")
+	}
+
+	pos, err := strconv.Atoi(args[1].Text)
+	if err != nil || pos < 1 {
+		return Response{}, errors.New("position must be a positive integer")
+	}
+
+	err = audited(ctx, req, s, "pin", func(s store.Store) (auditChange, error) {
+		before, err := s.GetPin(ctx, req.Chat, id)
+		if err != nil {
+			return auditChange{}, err
+		}
+		from, err := pinPosition(ctx, s, req.Chat, before)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.SetPinPosition(ctx, req.Chat, id, pos); err != nil {
+			return auditChange{}, err
+		}
+		return pinChange(ctx, s, req.Chat, pinSnapshot{Pin: before, Position: from}, true)
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Text: fmt.Sprintf("pin #%d moved to position %d", id, pos)}, nil
+}
+
+func pinFind(ctx context.Context, req Request, args Args, s store.Store) (Response, error) {
+	words := args
+
+	var basket string
+	if len(words) > 0 {
+		if name, ok := words[0].Option("in"); ok {
+			basket, words = name, words[1:]
+		}
+	}
+
+	if len(words) == 0 {
+		return Response{}, errors.New("missing search words")
+	}
+
+	query := words.Join()
+	matches, err := s.SearchPins(ctx, req.Chat, basket, query, findLimit+1)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(matches) == 0 {
+		return Response{Text: fmt.Sprintf("no pins match %q", query)}, nil
+	}
+
+	var out strings.Builder
+	if len(matches) > findLimit {
+		fmt.Fprintf(&out, "best %d matches for %q:\n", findLimit, query)
+		matches = matches[:findLimit]
+	} else {
+		fmt.Fprintf(&out, "pins matching %q:\n", query)
+	}
+	for _, m := range matches {
+		fmt.Fprintf(&out, "%d. [%s] %s\n", m.ID, m.Basket, m.Snippet)
+	}
+
+	return Response{Text: out.String()}, nil
+}
+
+// pinText is the content of p, after the kind and name of its file if it
+// has one.
+func pinText(p store.Pin) string {
+	if p.Media.IsZero() {
+		return p.Content
+	}
+
+	label := "[" + p.Media.Kind
+	if p.Media.Name != "" {
+		label += " " + p.Media.Name
+	}
+	label += "]"
+
+	if p.Content == "" {
+		return label
+	}
+	return label + " " + p.Content
+}
+
+// mention shortens a chat ID such as 911234567890@s.whatsapp.net to how
+// people are mentioned in chat.
+func mention(id string) string {
+	return "@" + userID(id)
+}
+
+// describeSource says who a pin was taken from and when.
+func describeSource(src store.PinSource, tz *time.Location) string {
+	if src.SentAt.IsZero() {
+		return "pinned from a message by " + mention(src.Sender)
+	}
+	return fmt.Sprintf("pinned from a message by %s on %s", mention(src.Sender), src.SentAt.In(tz).Format(store.DisplayFormat))
+}
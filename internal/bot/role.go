@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// userID strips the server and device from a chat ID such as
+// 911234567890:3@s.whatsapp.net, leaving the user.
+func userID(id string) string {
+	user, _, _ := strings.Cut(id, "@")
+	user, _, _ = strings.Cut(user, ":")
+	return user
+}
+
+// roleOf returns the role given to the sender of req with .role, or else the
+// one the chat gives them.
+func roleOf(ctx context.Context, req Request, s store.Store) (store.Role, error) {
+	role, ok, err := s.GetRole(ctx, req.Chat, userID(req.Sender.ID))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case ok:
+		return role, nil
+	case req.Sender.GroupAdmin != nil && req.Sender.GroupAdmin(ctx):
+		return store.RoleAdmin, nil
+	}
+	return store.RoleMember, nil
+}
+
+// allowed checks that the sender of req has at least the role need. An
+// empty need lets everyone through.
+func allowed(ctx context.Context, req Request, need store.Role, s store.Store) error {
+	if need == "" {
+		return nil
+	}
+
+	role, err := roleOf(ctx, req, s)
+	if err != nil {
+		return err
+	}
+
+	if !role.AtLeast(need) {
+		return fmt.Errorf("only %ss can use this command", need)
+	}
+
+	return nil
+}
+
+var errNoTarget = errors.New("mention a member or reply to one of their messages")
+
+// target takes the member from an @mention at args[0], or else from the
+// quoted message. It returns the remaining args.
+func target(req Request, args Args) (string, Args, error) {
+	if len(args) > 0 && strings.HasPrefix(args[0].Text, "@") {
+		if user := userID(args[0].Text[1:]); user != "" {
+			return user, args[1:], nil
+		}
+		return "", nil, errNoTarget
+	}
+	if req.Quoted != nil {
+		return userID(req.Quoted.Sender), args, nil
+	}
+	return "", nil, errNoTarget
+}
+
+func roleShow(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	role, err := roleOf(ctx, req, s)
+	if err != nil {
+		return "", err
+	}
+	return "your role is " + string(role), nil
+}
+
+func roleList(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	roles, err := s.ListRoles(ctx, req.Chat)
+	if err != nil {
+		return "", err
+	}
+
+	if len(roles) == 0 {
+		return "no roles given, group admins are admins and everyone else is a member", nil
+	}
+
+	var out strings.Builder
+	out.WriteString("roles:\n")
+	for _, r := range roles {
+		fmt.Fprintf(&out, "- @%s %s\n", r.User, r.Role)
+	}
+
+	return out.String(), nil
+}
+
+func roleSet(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	user, args, err := target(req, args)
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) == 0 {
+		return "", errors.New("missing role")
+	}
+
+	role, err := store.ParseRole(args[0].Text)
+	if err != nil {
+		return "", err
+	}
+
+	err = audited(ctx, req, s, "role", func(s store.Store) (auditChange, error) {
+		before, err := assignment(ctx, s, req.Chat, user)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.SetRole(ctx, req.Chat, user, role); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: user, before: before, after: store.RoleAssignment{User: user, Role: role}}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("@%s is now %s %s", user, article(role), role), nil
+}
+
+func roleReset(ctx context.Context, req Request, args Args, s store.Store) (string, error) {
+	user, _, err := target(req, args)
+	if err != nil {
+		return "", err
+	}
+
+	err = audited(ctx, req, s, "role", func(s store.Store) (auditChange, error) {
+		before, err := assignment(ctx, s, req.Chat, user)
+		if err != nil {
+			return auditChange{}, err
+		}
+
+		if err := s.ClearRole(ctx, req.Chat, user); err != nil {
+			return auditChange{}, err
+		}
+		return auditChange{target: user, before: before}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("@%s has their role from the group again", user), nil
+}
+
+// assignment returns the role given to user with .role, or nil if there is
+// none, for the audit log.
+func assignment(ctx context.Context, s store.Store, group, user string) (any, error) {
+	role, ok, err := s.GetRole(ctx, group, user)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return store.RoleAssignment{User: user, Role: role}, nil
+}
+
+func article(role store.Role) string {
+	if role == store.RoleAdmin {
+		return "an"
+	}
+	return "a"
+}
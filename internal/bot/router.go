@@ -2,10 +2,6 @@ package bot
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"math/rand/v2"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,304 +11,96 @@ import (
 
 type Response struct {
 	Text string
+	// ReplyTo makes the reply quote this message instead of the command.
+	ReplyTo *Quoted
+	// Media makes the reply this pinned file, with Text as its caption.
+	Media *store.PinMedia
 }
 
-const HELP = `Available commands:
-.d  deadlines
-.b  Manage baskets
-.p  Manage pins
-.t  Random coin toss
-.h  Print this message
+// Request is a command and the message it was sent in.
+type Request struct {
+	Text      string // the whole message, prefix included
+	Chat      string // chat ID, which is also the group whose data is used
+	MessageID string
+	Sender    Sender
+	SentAt    time.Time
+	Quoted    *Quoted // the message the command replied to, or nil
+
+	prefix  string // set by Handle, for replies that suggest a command
+	command string // set by Handle, such as "p edit"
+}
 
-Type any command to see its usage`
+// Sender is the group member who sent a command.
+type Sender struct {
+	ID   string // chat ID
+	Name string // push name, empty if unknown
+	// GroupAdmin reports whether the chat itself lists the sender as an
+	// admin. It may need a lookup, so it is only called when a command
+	// needs a role. Nil means the sender is not an admin.
+	GroupAdmin func(ctx context.Context) bool
+}
 
-func Handle(ctx context.Context, input string, prefix string, s store.Store) Response {
-	after, found := strings.CutPrefix(input, prefix)
+// Quoted is a message that a command was sent in reply to.
+type Quoted struct {
+	ID         string
+	Sender     string // chat ID of the sender
+	Text       string
+	SentAt     time.Time   // zero if unknown
+	Attachment *Attachment // nil for text messages
+}
+
+// Attachment is a file sent with a message.
+type Attachment struct {
+	Kind string // image, video, audio, document or sticker
+	MIME string
+	Name string
+	// Save downloads the file, keeps it and returns its SHA-256.
+	Save func(ctx context.Context) (string, error)
+}
+
+// Handle runs the command in req if its sender's role allows it.
+func Handle(ctx context.Context, req Request, prefix string, s store.Store) Response {
+	after, found := strings.CutPrefix(req.Text, prefix)
 
 	if !found {
 		return Response{Text: ""}
 	}
 
-	parts := strings.Fields(after)
+	req.prefix = prefix
+	parts := parseArgs(after)
 
 	if len(parts) == 0 {
-		return Response{Text: HELP}
-	}
-
-	switch parts[0] {
-	case "d":
-		result, err := deadlineHandler(ctx, parts[1:], s)
-		if err != nil {
-			log.Error().Err(err).Msg("deadline handler error")
-			return Response{Text: err.Error()}
-		}
-		return Response{Text: result}
-
-	case "b":
-		result, err := basketHandler(ctx, parts[1:], s)
-		if err != nil {
-			log.Error().Err(err).Msg("basket handler error")
-			return Response{Text: err.Error()}
-		}
-		return Response{Text: result}
-
-	case "p":
-		result, err := pinHandler(ctx, parts[1:], s)
-		if err != nil {
-			log.Error().Err(err).Msg("pin handler error")
-			return Response{Text: err.Error()}
-		}
-		return Response{Text: result}
-
-	case "t":
-		randomBool := rand.IntN(2)
-		var result string
-		if randomBool == 1 {
-			result = "heads"
-		} else {
-			result = "tails"
-		}
-		return Response{Text: result}
-
-	case "h":
-		return Response{Text: HELP}
+		return Response{Text: help(prefix)}
 	}
 
-	return Response{Text: HELP}
-}
-
-const BASKET_HELP = `Usage:
-.b get  list all baskets
-.b add [name]   add a new basket
-.b del [name]   remove a basket`
-
-func basketHandler(ctx context.Context, parts []string, s store.Store) (string, error) {
-	if len(parts) == 0 {
-		return BASKET_HELP, nil
+	cmd := findCommand(parts[0].Text)
+	if cmd == nil {
+		return Response{Text: help(prefix)}
 	}
 
-	// Which action to take
-	switch parts[0] {
-	case "add":
-		if len(parts) < 2 {
-			return "", errors.New("missing basket name")
-		}
-		name := parts[1]
-
-		if err := s.AddBasket(ctx, name); err != nil {
-			return "", err
-		}
-
-		return "basket created successfully", nil
-
-	case "get":
-		baskets, err := s.ListBaskets(ctx)
-
-		if err != nil {
-			return "", err
+	name, role, run, args := cmd.Name, cmd.Role, cmd.Run, parts[1:]
+	if len(args) > 0 {
+		if sub := cmd.subcommand(args[0].Text); sub != nil {
+			name, role, run, args = cmd.Name+" "+sub.Name, sub.Role, sub.Run, args[1:]
+		} else if len(cmd.Subcommands) > 0 {
+			run = nil
 		}
-
-		if len(baskets) == 0 {
-			return "there are no baskets", nil
-		}
-
-		var out strings.Builder
-		out.WriteString("list of baskets:\n")
-		for _, b := range baskets {
-			out.WriteString("- " + b + "\n")
-		}
-
-		return out.String(), nil
-
-	case "del":
-		if len(parts) < 2 {
-			return "", errors.New("missing basket name")
-		}
-		name := parts[1]
-
-		if err := s.DeleteBasket(ctx, name); err != nil {
-			return "", err
-		}
-
-		return "basket deleted successfully", nil
 	}
 
-	return BASKET_HELP, nil
-}
-
-const DEADLINE_HELP = `Usage:
-.d get   list all deadlines
-.d del [id]   remove a deadline
-.d add [date] [time] [title]   add a new deadline`
-
-func deadlineHandler(ctx context.Context, parts []string, s store.Store) (string, error) {
-	if len(parts) == 0 {
-		return DEADLINE_HELP, nil
+	if run == nil {
+		return Response{Text: usage(prefix, cmd)}
 	}
 
-	switch parts[0] {
-	case "get":
-		deadlines, err := s.ListDeadlines(ctx)
-
-		if err != nil {
-			return "", err
-		}
-
-		if len(deadlines) == 0 {
-			return "no upcoming deadlines", nil
-		}
-
-		tz := s.Timezone()
-		var out strings.Builder
-		out.WriteString("upcoming deadlines:\n")
-		for _, d := range deadlines {
-			localTime := d.DueAt.In(tz).Format(store.DisplayFormat)
-			fmt.Fprintf(&out, "%d. %s (%s)\n", d.ID, d.Title, localTime)
-		}
-
-		return out.String(), nil
-
-	case "add":
-		if len(parts) < 2 {
-			return "missing date, time, and title", nil
-		}
-
-		if len(parts) < 3 {
-			return "missing time and title", nil
-		}
-
-		if len(parts) < 4 {
-			return "missing title", nil
-		}
-
-		date := parts[1]
-		timeStr := parts[2]
-
-		inputTimeStr := date + " " + timeStr
-
-		const InputFormat = "2006-01-02 15:04"
-
-		tz := s.Timezone()
-
-		localDeadlineTime, err := time.ParseInLocation(
-			InputFormat,
-			inputTimeStr,
-			tz,
-		)
-		if err != nil {
-			return "", errors.New("invalid date/time format. Use YYYY-MM-DD HH:MM")
-		}
-
-		dueAt := localDeadlineTime.UTC()
-		title := strings.Join(parts[3:], " ")
-
-		d, err := s.AddDeadline(ctx, title, dueAt)
-		if err != nil {
-			return "", err
-		}
-
-		displayTime := d.DueAt.In(tz).Format(store.DisplayFormat)
-
-		return fmt.Sprintf(
-			"deadline #%d added: %s (%s)",
-			d.ID,
-			d.Title,
-			displayTime,
-		), nil
-
-	case "del":
-		if len(parts) < 2 {
-			return "", errors.New("missing deadline id")
-		}
-		idStr := parts[1]
-		id, err := strconv.Atoi(idStr)
-
-		if err != nil {
-			return "", errors.New("id must be an integer")
-		}
-
-		if err = s.DeleteDeadline(ctx, id); err != nil {
-			return "", err
-		}
-
-		return fmt.Sprintf("deadline #%d deleted successfully", id), nil
+	if err := allowed(ctx, req, role, s); err != nil {
+		log.Info().Err(err).Str("command", name).Str("sender", req.Sender.ID).Msg("command refused")
+		return Response{Text: err.Error()}
 	}
 
-	return DEADLINE_HELP, nil
-}
-
-const PIN_HELP = `Usage:
-.p get [basket]   list all pins in a basket
-.p add [basket] [content]   add a new pin
-.p del [id]   remove a pin from a basket`
-
-func pinHandler(ctx context.Context, parts []string, s store.Store) (string, error) {
-	if len(parts) == 0 {
-		return PIN_HELP, nil
+	req.command = name
+	resp, err := run(ctx, req, args, s)
+	if err != nil {
+		log.Error().Err(err).Str("command", name).Msg("command error")
+		return Response{Text: err.Error()}
 	}
-
-	switch parts[0] {
-	case "get":
-		if len(parts) < 2 {
-			return "", errors.New("missing basket name")
-		}
-
-		name := parts[1]
-		pins, err := s.ListPins(ctx, name)
-
-		if err != nil {
-			return "", err
-		}
-
-		if len(pins) == 0 {
-			return "no pins in basket " + name, nil
-		}
-
-		var out strings.Builder
-		out.WriteString(name + " pins:\n")
-		for _, p := range pins {
-			fmt.Fprintf(&out, "%d. %s\n", p.ID, p.Content)
-		}
-
-		return out.String(), nil
-
-	case "add":
-		if len(parts) < 2 {
-			return "", errors.New("missing basket name")
-		}
-
-		if len(parts) < 3 {
-			return "", errors.New("missing pin content")
-		}
-
-		name := parts[1]
-		content := strings.Join(parts[2:], " ")
-		pin, err := s.AddPin(ctx, name, content)
-
-		if err != nil {
-			return "", err
-		}
-
-		return fmt.Sprintf("pin #%d added to %s", pin.ID, name), nil
-
-	case "del":
-		if len(parts) < 2 {
-			return "", errors.New("missing pin id")
-		}
-
-		idStr := parts[1]
-		id, err := strconv.Atoi(idStr)
-
-		if err != nil {
-			return "", errors.New("id must be an integer")
-		}
-
-		if err = s.DeletePin(ctx, id); err != nil {
-			return "", err
-		}
-
-		return fmt.Sprintf("pin #%d successfully deleted", id), nil
-	}
-
-	return PIN_HELP, nil
+	return resp
 }
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrChatNotFound = errors.New("chat not found")
+
+// Message is an incoming chat message, independent of the transport it
+// arrived on. Chat and Sender are opaque, transport-specific identifiers.
+type Message struct {
+	ID         string
+	Chat       string
+	Sender     string
+	SenderName string // the name the sender goes by, empty if unknown
+	Text       string
+	Time       time.Time // when it was sent, zero if unknown
+	IsFromMe   bool
+
+	// Attachment is the file sent with the message, or nil. Text is then
+	// its caption.
+	Attachment *Attachment
+
+	// Quoted is the message this one replies to, or nil. Its Chat and
+	// IsFromMe are not set, and neither is Time if the transport can't tell.
+	Quoted *Message
+}
+
+// Attachment is a file sent with a message. It is only downloaded when
+// needed.
+type Attachment struct {
+	Kind string // image, video, audio, document or sticker
+	MIME string
+	Name string // file name, if the sender gave one
+	Size int64  // in bytes, 0 if unknown
+
+	// Download fetches the file from the transport. It fails once the
+	// transport no longer has it.
+	Download func(ctx context.Context) ([]byte, error)
+}
+
+// File is a file to send.
+type File struct {
+	Kind string // as in Attachment
+	MIME string
+	Name string
+	Data []byte
+}
+
+// Messenger is the outgoing side of a chat transport such as WhatsApp.
+type Messenger interface {
+	// SendText posts text to a chat.
+	SendText(ctx context.Context, chat string, text string) error
+	// SendReply posts text to the chat of msg, quoting msg.
+	SendReply(ctx context.Context, msg Message, text string) error
+	// React reacts to msg with an emoji.
+	React(ctx context.Context, msg Message, emoji string) error
+	// ResolveChat looks up a chat identifier by its display name. It returns
+	// ErrChatNotFound if no such chat exists.
+	ResolveChat(ctx context.Context, name string) (string, error)
+}
+
+// MediaSender is implemented by messengers that can send files.
+type MediaSender interface {
+	SendMedia(ctx context.Context, chat string, file File, caption string) error
+}
+
+// AdminChecker is implemented by messengers that know who administers a
+// chat. user is a chat ID as in Message.Sender.
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, chat string, user string) (bool, error)
+}
+
+// KeyedSender is implemented by messengers that can tag an outgoing message
+// with a caller-chosen key, which the transport may use to drop a second copy
+// sent with the same key. That is best effort, so callers must still avoid
+// sending a message twice.
+type KeyedSender interface {
+	SendTextKeyed(ctx context.Context, chat string, key string, text string) error
+}
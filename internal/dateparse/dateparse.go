@@ -0,0 +1,396 @@
+// Package dateparse reads the loosely written dates people type into chat,
+// such as "tomorrow 23:59", "fri 5pm", "in 3 days" or "25/12 10:00".
+package dateparse
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dates given without a time of day resolve to this time, the last minute of
+// the day, which is what people usually mean by a deadline on that day.
+const (
+	DefaultHour   = 23
+	DefaultMinute = 59
+)
+
+var ErrNoDate = errors.New("no date or time found")
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+// Parse reads a date and/or time from the beginning of words, resolved in loc
+// relative to now. It returns the parsed time and how many words it used, so
+// the caller can treat the remaining words as something else (a title, say).
+//
+// Dates without a year resolve to their next occurrence, and a weekday or a
+// bare time that has already passed today moves to the following week or day.
+// Parse returns ErrNoDate if words do not start with anything it understands.
+func Parse(words []string, now time.Time, loc *time.Location) (time.Time, int, error) {
+	p := parser{
+		words: lowerAll(words),
+		now:   now.In(loc),
+		loc:   loc,
+	}
+	return p.parse()
+}
+
+type parser struct {
+	words []string
+	pos   int
+	now   time.Time
+	loc   *time.Location
+}
+
+func (p *parser) peek(offset int) string {
+	if p.pos+offset < len(p.words) {
+		return p.words[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *parser) parse() (time.Time, int, error) {
+	if t, ok, err := p.relative(); ok || err != nil {
+		return t, p.pos, err
+	}
+
+	date, rollover, ok, err := p.date()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	// An optional "at" may sit between the date and the time.
+	start := p.pos
+	if ok && p.peek(0) == "at" {
+		p.pos++
+	}
+
+	hour, minute, hasTime, err := p.clock()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if !hasTime {
+		p.pos = start
+	}
+
+	switch {
+	case !ok && !hasTime:
+		return time.Time{}, 0, ErrNoDate
+
+	case !ok:
+		// A bare time means the next time the clock shows it.
+		t := p.at(p.now, hour, minute)
+		if !t.After(p.now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, p.pos, nil
+
+	case !hasTime:
+		hour, minute = DefaultHour, DefaultMinute
+	}
+
+	t := p.at(date, hour, minute)
+	if rollover != nil && !t.After(p.now) {
+		t = rollover(t)
+	}
+
+	return t, p.pos, nil
+}
+
+// relative parses "in <n> <unit>" and "in <n><unit>", such as "in 3 days",
+// "in 2h" or "in 1 week 10:00".
+func (p *parser) relative() (time.Time, bool, error) {
+	if p.peek(0) != "in" {
+		return time.Time{}, false, nil
+	}
+
+	numStr, unit, used := p.peek(1), p.peek(2), 3
+	if i := strings.IndexFunc(numStr, isLetter); i > 0 {
+		numStr, unit, used = numStr[:i], numStr[i:], 2
+	}
+
+	n, err := strconv.Atoi(numStr)
+	if err != nil || n < 0 {
+		return time.Time{}, false, nil
+	}
+
+	var (
+		d    time.Duration
+		days int
+	)
+	switch unit {
+	case "m", "min", "mins", "minute", "minutes":
+		d = time.Duration(n) * time.Minute
+	case "h", "hr", "hrs", "hour", "hours":
+		d = time.Duration(n) * time.Hour
+	case "d", "day", "days":
+		days = n
+	case "w", "wk", "wks", "week", "weeks":
+		days = 7 * n
+	default:
+		return time.Time{}, false, nil
+	}
+
+	p.pos += used
+
+	if d > 0 || days == 0 {
+		return p.now.Add(d).Truncate(time.Minute), true, nil
+	}
+
+	date := p.now.AddDate(0, 0, days)
+
+	// "in 3 days" keeps the current time of day unless another is given.
+	start := p.pos
+	if p.peek(0) == "at" {
+		p.pos++
+	}
+	hour, minute, hasTime, err := p.clock()
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	if !hasTime {
+		p.pos = start
+		hour, minute = p.now.Hour(), p.now.Minute()
+	}
+
+	return p.at(date, hour, minute), true, nil
+}
+
+// date parses the day part of the input. If the day was given without a year
+// or week, rollover moves a time that has already passed to the next such
+// day.
+func (p *parser) date() (time.Time, func(time.Time) time.Time, bool, error) {
+	w := p.peek(0)
+	nextYear := func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	nextWeek := func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+
+	switch w {
+	case "today", "tonight":
+		p.pos++
+		return p.now, nil, true, nil
+	case "tomorrow", "tmr", "tmrw", "tomorow":
+		p.pos++
+		return p.now.AddDate(0, 0, 1), nil, true, nil
+	case "next", "this":
+		if wd, ok := weekdays[p.peek(1)]; ok {
+			p.pos += 2
+			ahead := daysUntil(p.now.Weekday(), wd)
+			if w == "next" && ahead == 0 {
+				ahead = 7
+			}
+			return p.now.AddDate(0, 0, ahead), nil, true, nil
+		}
+		return time.Time{}, nil, false, nil
+	}
+
+	if wd, ok := weekdays[w]; ok {
+		p.pos++
+		return p.now.AddDate(0, 0, daysUntil(p.now.Weekday(), wd)), nextWeek, true, nil
+	}
+
+	// 2006-01-02
+	if t, err := time.ParseInLocation("2006-01-02", w, p.loc); err == nil {
+		p.pos++
+		return t, nil, true, nil
+	}
+
+	// 25/12 and 25/12/2025
+	if strings.Count(w, "/") > 0 {
+		parts := strings.Split(w, "/")
+		if len(parts) > 3 {
+			return time.Time{}, nil, false, nil
+		}
+
+		nums := make([]int, len(parts))
+		for i, s := range parts {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return time.Time{}, nil, false, nil
+			}
+			nums[i] = n
+		}
+
+		if len(nums) == 2 {
+			t, err := p.day(p.now.Year(), time.Month(nums[1]), nums[0])
+			if err != nil {
+				return time.Time{}, nil, false, err
+			}
+			p.pos++
+			return t, nextYear, true, nil
+		}
+
+		year := nums[2]
+		if year < 100 {
+			year += 2000
+		}
+		t, err := p.day(year, time.Month(nums[1]), nums[0])
+		if err != nil {
+			return time.Time{}, nil, false, err
+		}
+		p.pos++
+		return t, nil, true, nil
+	}
+
+	// dec 25 and 25 dec, optionally followed by a year
+	var (
+		month   time.Month
+		day     int
+		isMonth bool
+	)
+	if m, ok := months[w]; ok {
+		if n, err := strconv.Atoi(trimOrdinal(p.peek(1))); err == nil {
+			month, day, isMonth = m, n, true
+		}
+	} else if n, err := strconv.Atoi(trimOrdinal(w)); err == nil {
+		if m, ok := months[p.peek(1)]; ok {
+			month, day, isMonth = m, n, true
+		}
+	}
+	if !isMonth {
+		return time.Time{}, nil, false, nil
+	}
+
+	if y, err := strconv.Atoi(p.peek(2)); err == nil && len(p.peek(2)) == 4 {
+		t, err := p.day(y, month, day)
+		if err != nil {
+			return time.Time{}, nil, false, err
+		}
+		p.pos += 3
+		return t, nil, true, nil
+	}
+
+	t, err := p.day(p.now.Year(), month, day)
+	if err != nil {
+		return time.Time{}, nil, false, err
+	}
+	p.pos += 2
+	return t, nextYear, true, nil
+}
+
+// clock parses a time of day: 17:30, 5pm, 5:30pm, 5 pm or noon. Bare numbers
+// are not times, so titles starting with one are left alone.
+func (p *parser) clock() (int, int, bool, error) {
+	w := p.peek(0)
+
+	switch w {
+	case "":
+		return 0, 0, false, nil
+	case "noon", "midday":
+		p.pos++
+		return 12, 0, true, nil
+	case "midnight":
+		// People mean the end of the day, not its first minute.
+		p.pos++
+		return 23, 59, true, nil
+	}
+
+	used := 1
+	suffix := ""
+	switch {
+	case strings.HasSuffix(w, "am"), strings.HasSuffix(w, "pm"):
+		w, suffix = w[:len(w)-2], w[len(w)-2:]
+	case p.peek(1) == "am", p.peek(1) == "pm":
+		suffix = p.peek(1)
+		used = 2
+	}
+
+	hourStr, minStr, hasColon := strings.Cut(w, ":")
+	if !hasColon && suffix == "" {
+		return 0, 0, false, nil
+	}
+
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil {
+		return 0, 0, false, nil
+	}
+
+	minute := 0
+	if hasColon {
+		if len(minStr) != 2 {
+			return 0, 0, false, nil
+		}
+		minute, err = strconv.Atoi(minStr)
+		if err != nil {
+			return 0, 0, false, nil
+		}
+	}
+
+	if suffix != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false, errors.New("invalid time " + p.peek(0))
+		}
+		hour %= 12
+		if suffix == "pm" {
+			hour += 12
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0, 0, false, errors.New("invalid time " + p.peek(0))
+	}
+
+	p.pos += used
+	return hour, minute, true, nil
+}
+
+func (p *parser) day(year int, month time.Month, day int) (time.Time, error) {
+	t := time.Date(year, month, day, 0, 0, 0, 0, p.loc)
+	if month < time.January || month > time.December || t.Day() != day || t.Month() != month {
+		return time.Time{}, errors.New("invalid date " + p.peek(0))
+	}
+	return t, nil
+}
+
+func (p *parser) at(date time.Time, hour, minute int) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, hour, minute, 0, 0, p.loc)
+}
+
+func daysUntil(from, to time.Weekday) int {
+	return (int(to) - int(from) + 7) % 7
+}
+
+func trimOrdinal(s string) string {
+	for _, suf := range []string{"st", "nd", "rd", "th"} {
+		if t, ok := strings.CutSuffix(s, suf); ok {
+			return t
+		}
+	}
+	return s
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+func lowerAll(words []string) []string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = strings.ToLower(w)
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package dateparse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tz := time.FixedZone("IST", 5*60*60+30*60)
+
+	// Wednesday
+	now := time.Date(2025, time.January, 15, 14, 30, 0, 0, tz)
+
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, tz)
+	}
+
+	tests := []struct {
+		in   string
+		want time.Time
+		used int
+	}{
+		// Absolute dates
+		{"2025-01-20 10:00 report", at(time.January, 20, 10, 0), 2},
+		{"2025-01-20 report", at(time.January, 20, 23, 59), 1},
+		{"2026-03-01 9am", time.Date(2026, time.March, 1, 9, 0, 0, 0, tz), 2},
+		{"25/12 10:00", at(time.December, 25, 10, 0), 2},
+		{"25/12/2026", time.Date(2026, time.December, 25, 23, 59, 0, 0, tz), 1},
+		{"1/2/26 5pm", time.Date(2026, time.February, 1, 17, 0, 0, 0, tz), 2},
+		{"dec 25", at(time.December, 25, 23, 59), 2},
+		{"25 dec at 8pm", at(time.December, 25, 20, 0), 4},
+		{"December 25th 2026", time.Date(2026, time.December, 25, 23, 59, 0, 0, tz), 3},
+
+		// Dates without a year roll over once passed
+		{"10/1", time.Date(2026, time.January, 10, 23, 59, 0, 0, tz), 1},
+		{"jan 15 14:00", time.Date(2026, time.January, 15, 14, 0, 0, 0, tz), 3},
+		{"jan 15 15:00", at(time.January, 15, 15, 0), 3},
+
+		// Named days
+		{"today 18:00", at(time.January, 15, 18, 0), 2},
+		{"tonight", at(time.January, 15, 23, 59), 1},
+		{"tomorrow 23:59", at(time.January, 16, 23, 59), 2},
+		{"Tomorrow at 9 am", at(time.January, 16, 9, 0), 4},
+		{"tmrw noon", at(time.January, 16, 12, 0), 2},
+
+		// Weekdays
+		{"fri 5pm", at(time.January, 17, 17, 0), 2},
+		{"friday", at(time.January, 17, 23, 59), 1},
+		{"wed 18:00", at(time.January, 15, 18, 0), 2},
+		{"wed 9am", at(time.January, 22, 9, 0), 2},
+		{"next monday", at(time.January, 20, 23, 59), 2},
+		{"next wed 10:00", at(time.January, 22, 10, 0), 3},
+		{"this sat midnight", at(time.January, 18, 23, 59), 3},
+
+		// Relative
+		{"in 3 days", at(time.January, 18, 14, 30), 3},
+		{"in 3 days 9am", at(time.January, 18, 9, 0), 4},
+		{"in 2h lab", at(time.January, 15, 16, 30), 2},
+		{"in 45 minutes", at(time.January, 15, 15, 15), 3},
+		{"in 1 week", at(time.January, 22, 14, 30), 3},
+
+		// Bare times
+		{"17:00", at(time.January, 15, 17, 0), 1},
+		{"9:15am", at(time.January, 16, 9, 15), 1},
+		{"12am", at(time.January, 16, 0, 0), 1},
+		{"12pm", at(time.January, 16, 12, 0), 1},
+
+		// Numbers after a date are not times
+		{"fri 5 problems", at(time.January, 17, 23, 59), 1},
+		{"tomorrow at the lab", at(time.January, 16, 23, 59), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, used, err := Parse(strings.Fields(tt.in), now, tz)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.in, err)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+
+			if used != tt.used {
+				t.Fatalf("Parse(%q) used %d words, want %d", tt.in, used, tt.used)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tz := time.UTC
+	now := time.Date(2025, time.January, 15, 14, 30, 0, 0, tz)
+
+	tests := []string{
+		"",
+		"homework",
+		"5 problems",
+		"in a while",
+		"next week",
+		"31/02",
+		"2025-13-01",
+		"feb 30",
+		"tomorrow 13pm",
+		"tomorrow 25:00",
+	}
+
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			got, _, err := Parse(strings.Fields(in), now, tz)
+			if err == nil {
+				t.Fatalf("Parse(%q) = %v, want error", in, got)
+			}
+		})
+	}
+}
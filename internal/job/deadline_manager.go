@@ -2,127 +2,440 @@ package job
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/kaezrr/remy-bot/internal/chat"
 	"github.com/kaezrr/remy-bot/internal/store"
 	"github.com/rs/zerolog/log"
+)
+
+// CatchUpPolicy decides what happens to reminders that were missed because
+// the bot was offline when they were due.
+type CatchUpPolicy string
+
+const (
+	// CatchUpSummary sends one message per group listing what was missed.
+	CatchUpSummary CatchUpPolicy = "summary"
+	// CatchUpSkip drops missed reminders silently.
+	CatchUpSkip CatchUpPolicy = "skip"
+)
 
-	"go.mau.fi/whatsmeow"
-	waE2E "go.mau.fi/whatsmeow/proto/waE2E"
-	waTypes "go.mau.fi/whatsmeow/types"
-	"google.golang.org/protobuf/proto"
+// A reminder this late was missed rather than just picked up a little late.
+const missedAfter = 5 * time.Minute
+
+// The manager rechecks at least this often, in case the database was changed
+// behind the store's back or the system clock jumped.
+const maxSleep = time.Hour
+
+// Delivery of a failed message is retried after an exponentially growing
+// delay, until it is too old to be worth sending.
+const (
+	retryBase     = 10 * time.Second
+	retryMax      = 15 * time.Minute
+	maxMessageAge = 24 * time.Hour
 )
 
+// Delivered and dropped messages are deleted from the outbox once they are
+// older than maxMessageAge, checking this often.
+const pruneInterval = time.Hour
+
 type DeadlineManager struct {
-	Client    *whatsmeow.Client
+	Messenger chat.Messenger
 	Store     store.Store
-	TargetJID waTypes.JID
-}
+	CatchUp   CatchUpPolicy
+	Clock     Clock // defaults to the system clock
 
-func sendGroupMessage(client *whatsmeow.Client, jid waTypes.JID, text string) {
-	waMsg := &waE2E.Message{
-		Conversation: proto.String(text),
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Groups limits the manager to the deadlines and messages of these
+	// groups, so bots sharing a database leave each other's alone. Empty
+	// means every group.
+	Groups []string
 
-	if _, err := client.SendMessage(ctx, jid, waMsg); err != nil {
-		log.Error().Err(err).Str("jid", jid.String()).Msg("Job: failed to send message")
-	}
+	// sent holds the IDs of messages that were sent but could not be marked
+	// delivered. They are marked again instead of being sent twice.
+	sent map[int]bool
+	// pruned is when the outbox was last pruned.
+	pruned time.Time
 }
 
+// Start runs the manager until ctx is cancelled. It sleeps until the earliest
+// pending reminder or message retry and is woken early whenever deadlines
+// change in the store.
+//
+// Reminders are not sent directly. Handling a reminder queues its message in
+// the store's outbox in the same transaction that moves the deadline on, and
+// the outbox is then delivered, so a crash or send failure neither loses nor
+// repeats a reminder.
 func (dm *DeadlineManager) Start(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Minute)
-	defer ticker.Stop()
+	log.Info().Msg("Job: Deadline manager started.")
 
-	log.Info().Msg("Job: Deadline manager started, checking every 10 minutes.")
+	for {
+		ok := dm.runChecks(ctx)
+		if !dm.deliver(ctx) {
+			ok = false
+		}
+		dm.prune(ctx)
 
-	dm.runChecks(ctx) // Run checks immediately upon startup
+		wait := dm.untilNextEvent(ctx)
+		if !ok {
+			// Whatever failed is likely still due, so back off rather
+			// than retrying at once.
+			wait = max(wait, retryDelay(1))
+		}
+		log.Info().Dur("wait", wait).Msg("Job: Deadline manager sleeping.")
+
+		timer := dm.clock().NewTimer(wait)
 
-	for {
 		select {
-		case <-ticker.C:
-			log.Info().Msg("Job: Deadline manager checking now.")
-			dm.runChecks(ctx)
+		case <-timer.C():
+		case <-dm.Store.Changes():
+			timer.Stop()
+			log.Info().Msg("Job: Deadlines changed, rescheduling.")
 		case <-ctx.Done():
+			timer.Stop()
 			log.Info().Msg("Job: Deadline manager shutting down.")
 			return
 		}
 	}
 }
 
-func (dm *DeadlineManager) runChecks(ctx context.Context) {
-	now := time.Now().UTC()
+func (dm *DeadlineManager) clock() Clock {
+	if dm.Clock == nil {
+		return realClock{}
+	}
+	return dm.Clock
+}
+
+func (dm *DeadlineManager) untilNextEvent(ctx context.Context) time.Duration {
+	now := dm.clock().Now()
+	wait := maxSleep
+
+	next, ok, err := dm.Store.NextReminderAt(ctx, dm.Groups)
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to fetch next reminder")
+	} else if ok {
+		wait = min(wait, next.Sub(now))
+	}
+
+	next, ok, err = dm.Store.NextDeliveryAt(ctx, dm.Groups)
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to fetch next delivery")
+	} else if ok {
+		wait = min(wait, next.Sub(now))
+	}
+
+	return max(wait, 0)
+}
+
+// runChecks handles every reminder that is due. It returns false if the
+// store could not be read or updated.
+func (dm *DeadlineManager) runChecks(ctx context.Context) bool {
+	now := dm.clock().Now().UTC()
 
-	deadlines, err := dm.Store.ListDueDeadlines(ctx, now)
+	deadlines, err := dm.Store.ListDueDeadlines(ctx, dm.Groups, now)
 	if err != nil {
 		log.Error().Err(err).Msg("Job: failed to fetch due deadlines")
-		return
+		return false
 	}
 
+	ok := true
+
+	var (
+		groups        []string
+		missedLines   = map[string][]string{}
+		missedChanges = map[string][]store.DeadlineChange{}
+	)
+
 	for _, d := range deadlines {
-		if d.NextRemindIndex == -1 {
-			log.Info().
-				Int("id", d.ID).
-				Str("title", d.Title).
-				Msg("Job: deadline expired")
-
-			msg := fmt.Sprintf(
-				"*DEADLINE EXPIRED*\n*%s*\nIt was due at: %s",
-				d.Title,
-				d.DueAt.In(dm.Store.Timezone()).Format(store.DisplayFormat),
-			)
-			sendGroupMessage(dm.Client, dm.TargetJID, msg)
-
-			if err := dm.Store.DeleteDeadline(ctx, d.ID); err != nil {
-				log.Error().
-					Err(err).
-					Int("id", d.ID).
-					Msg("Job: failed to delete expired deadline")
+		if now.Sub(d.NextReminder) > missedAfter {
+			line, change := dm.catchUp(d, now)
+
+			if _, ok := missedLines[d.GroupID]; !ok {
+				groups = append(groups, d.GroupID)
 			}
+			missedLines[d.GroupID] = append(missedLines[d.GroupID], line)
+			missedChanges[d.GroupID] = append(missedChanges[d.GroupID], change)
 			continue
 		}
 
-		remaining := max(d.DueAt.Sub(now), 0)
+		var (
+			msg    string
+			change store.DeadlineChange
+		)
+		if d.NextRemindIndex == -1 {
+			msg, change = dm.expire(d, now)
+		} else {
+			msg, change = dm.remind(d, now)
+		}
+
+		if !dm.apply(ctx, []store.DeadlineChange{change}, []store.OutboxMessage{{Chat: d.GroupID, Text: msg}}) {
+			ok = false
+		}
+	}
+
+	for _, group := range groups {
+		var messages []store.OutboxMessage
+		if dm.CatchUp != CatchUpSkip {
+			messages = append(messages, store.OutboxMessage{
+				Chat: group,
+				Text: "*WHILE I WAS OFFLINE*\n" + strings.Join(missedLines[group], "\n"),
+			})
+		}
 
-		log.Info().
-			Int("id", d.ID).
-			Str("title", d.Title).
-			Int("index", d.NextRemindIndex).
-			Dur("remaining", remaining).
-			Msg("Job: sending reminder")
+		if !dm.apply(ctx, missedChanges[group], messages) {
+			ok = false
+		}
+	}
 
-		msg := fmt.Sprintf(
-			"*REMINDER*\n*%s*\nIt is due in *%s*",
-			d.Title,
-			formatDuration(remaining),
-		)
-		sendGroupMessage(dm.Client, dm.TargetJID, msg)
+	log.Info().Msg("Job: reminder cycle finished")
+	return ok
+}
+
+// apply saves changes and queues messages, returning false if that failed
+// for any reason but a concurrent edit.
+func (dm *DeadlineManager) apply(ctx context.Context, changes []store.DeadlineChange, messages []store.OutboxMessage) bool {
+	err := dm.Store.ApplyDeadlineChanges(ctx, changes, messages)
+
+	if errors.Is(err, store.ErrStaleDeadline) {
+		// Someone edited the deadline meanwhile. That wakes the manager
+		// again, and the next cycle works from the new state.
+		log.Warn().Err(err).Msg("Job: deadline changed while handling it")
+		return true
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to save deadline changes")
+		return false
+	}
+
+	return true
+}
+
+// deliver sends every queued message that is due, scheduling a retry for
+// those that fail. It returns false if the store could not be read or
+// updated.
+func (dm *DeadlineManager) deliver(ctx context.Context) bool {
+	now := dm.clock().Now().UTC()
 
-		// Schedule next event
-		nextIndex := d.NextRemindIndex - 1
+	messages, err := dm.Store.PendingMessages(ctx, dm.Groups, now)
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to fetch pending messages")
+		return false
+	}
 
-		if nextIndex < 0 {
-			if err := dm.Store.UpdateNextReminder(ctx, d.ID, d.DueAt, -1); err != nil {
-				log.Error().
-					Err(err).
-					Int("id", d.ID).
-					Msg("Job: failed to schedule expiration")
+	ok := true
+	for _, m := range messages {
+		if dm.sent[m.ID] {
+			if err := dm.Store.MarkDelivered(ctx, m.ID); err != nil {
+				log.Error().Err(err).Int("message", m.ID).Msg("Job: failed to mark message delivered")
+				ok = false
+				continue
 			}
-		} else {
-			nextTime := d.DueAt.Add(-store.ReminderSchedule[nextIndex])
-			if err := dm.Store.UpdateNextReminder(ctx, d.ID, nextTime, nextIndex); err != nil {
-				log.Error().
-					Err(err).
-					Int("id", d.ID).
-					Msg("Job: failed to schedule next reminder")
+			delete(dm.sent, m.ID)
+			continue
+		}
+
+		sendErr := dm.send(ctx, m)
+
+		if sendErr == nil {
+			if err := dm.Store.MarkDelivered(ctx, m.ID); err != nil {
+				log.Error().Err(err).Int("message", m.ID).Msg("Job: failed to mark message delivered")
+				if dm.sent == nil {
+					dm.sent = map[int]bool{}
+				}
+				dm.sent[m.ID] = true
+				ok = false
 			}
+			continue
+		}
+
+		retryAt := now.Add(retryDelay(m.Attempts + 1))
+		if retryAt.Sub(m.CreatedAt) > maxMessageAge {
+			retryAt = time.Time{}
+		}
+
+		log.Error().
+			Err(sendErr).
+			Int("message", m.ID).
+			Str("jid", m.Chat).
+			Int("attempt", m.Attempts+1).
+			Time("retry_at", retryAt).
+			Msg("Job: failed to send message")
+
+		if err := dm.Store.MarkFailed(ctx, m.ID, sendErr.Error(), retryAt); err != nil {
+			log.Error().Err(err).Int("message", m.ID).Msg("Job: failed to record failed delivery")
+			ok = false
 		}
 	}
 
-	log.Info().Msg("Job: reminder cycle finished")
+	return ok
+}
+
+// prune deletes finished messages from the outbox, at most once every
+// pruneInterval.
+func (dm *DeadlineManager) prune(ctx context.Context) {
+	now := dm.clock().Now()
+	if now.Sub(dm.pruned) < pruneInterval {
+		return
+	}
+	dm.pruned = now
+
+	n, err := dm.Store.PruneOutbox(ctx, dm.Groups, now.Add(-maxMessageAge))
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to prune outbox")
+		return
+	}
+
+	if n > 0 {
+		log.Info().Int("messages", n).Msg("Job: pruned outbox")
+	}
+}
+
+func (dm *DeadlineManager) send(ctx context.Context, m store.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if ks, ok := dm.Messenger.(chat.KeyedSender); ok {
+		return ks.SendTextKeyed(ctx, m.Chat, m.Key, m.Text)
+	}
+
+	return dm.Messenger.SendText(ctx, m.Chat, m.Text)
+}
+
+// retryDelay is how long to wait before the given delivery attempt.
+func retryDelay(attempt int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempt && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+// expire announces that a deadline has passed and either moves a repeating
+// deadline to its next occurrence or deletes it.
+func (dm *DeadlineManager) expire(d store.Deadline, now time.Time) (string, store.DeadlineChange) {
+	log.Info().
+		Int("id", d.ID).
+		Str("group", d.GroupID).
+		Str("title", d.Title).
+		Msg("Job: deadline expired")
+
+	tz := dm.Store.Timezone()
+	msg := fmt.Sprintf(
+		"*DEADLINE EXPIRED*\n*%s*\nIt was due at: %s",
+		d.Title,
+		d.DueAt.In(tz).Format(store.DisplayFormat),
+	)
+
+	next, repeats := nextOccurrence(d, now, tz)
+	if repeats {
+		msg += fmt.Sprintf("\nNext due: %s", next.In(tz).Format(store.DisplayFormat))
+	}
+
+	return msg, finish(d, next, repeats, now)
+}
+
+// finish is the change that ends the current occurrence of a deadline.
+func finish(d store.Deadline, next time.Time, repeats bool, now time.Time) store.DeadlineChange {
+	if !repeats {
+		return store.DeadlineChange{From: d, Delete: true}
+	}
+
+	advanced := d
+	advanced.DueAt = next
+	nextTime, nextIndex := advanced.ReminderAfter(now)
+
+	return store.DeadlineChange{
+		From:            d,
+		DueAt:           next,
+		NextReminder:    nextTime,
+		NextRemindIndex: nextIndex,
+	}
+}
+
+func (dm *DeadlineManager) remind(d store.Deadline, now time.Time) (string, store.DeadlineChange) {
+	remaining := max(d.DueAt.Sub(now), 0)
+
+	log.Info().
+		Int("id", d.ID).
+		Str("group", d.GroupID).
+		Str("title", d.Title).
+		Int("index", d.NextRemindIndex).
+		Dur("remaining", remaining).
+		Msg("Job: sending reminder")
+
+	msg := fmt.Sprintf(
+		"*REMINDER*\n*%s*\nIt is due in *%s*",
+		d.Title,
+		formatDuration(remaining),
+	)
+
+	// Schedule next event
+	change := store.DeadlineChange{
+		From:            d,
+		NextReminder:    d.DueAt,
+		NextRemindIndex: d.NextRemindIndex - 1,
+	}
+	if change.NextRemindIndex >= 0 {
+		change.NextReminder = d.DueAt.Add(-d.Reminders[change.NextRemindIndex])
+	}
+
+	return msg, change
+}
+
+// catchUp handles a deadline whose next reminder was missed. Instead of
+// sending the stale reminder it jumps straight to the reminder that fits the
+// current time, or finishes the deadline if it expired in the meantime. It
+// returns a line describing the deadline for the offline summary.
+func (dm *DeadlineManager) catchUp(d store.Deadline, now time.Time) (string, store.DeadlineChange) {
+	tz := dm.Store.Timezone()
+
+	log.Info().
+		Int("id", d.ID).
+		Str("group", d.GroupID).
+		Str("title", d.Title).
+		Time("missed", d.NextReminder).
+		Msg("Job: catching up on missed reminder")
+
+	if !d.DueAt.After(now) {
+		line := fmt.Sprintf(
+			"- *%s* expired on %s",
+			d.Title,
+			d.DueAt.In(tz).Format(store.DisplayFormat),
+		)
+
+		next, repeats := nextOccurrence(d, now, tz)
+		if repeats {
+			line += fmt.Sprintf(", next due %s", next.In(tz).Format(store.DisplayFormat))
+		}
+
+		return line, finish(d, next, repeats, now)
+	}
+
+	nextTime, nextIndex := d.ReminderAfter(now)
+	line := fmt.Sprintf(
+		"- *%s* is due in *%s*",
+		d.Title,
+		formatDuration(d.DueAt.Sub(now)),
+	)
+
+	return line, store.DeadlineChange{
+		From:            d,
+		NextReminder:    nextTime,
+		NextRemindIndex: nextIndex,
+	}
+}
+
+// nextOccurrence returns the first occurrence of a repeating deadline that is
+// still in the future, skipping any that passed while the bot was offline.
+func nextOccurrence(d store.Deadline, now time.Time, tz *time.Location) (time.Time, bool) {
+	next, ok := d.Recurrence.Next(d.DueAt, tz)
+	for ok && !next.After(now) {
+		next, ok = d.Recurrence.Next(next, tz)
+	}
+	return next, ok
 }
 
 func formatDuration(d time.Duration) string {
@@ -0,0 +1,693 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/chat"
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+type sentMessage struct {
+	chat string
+	text string
+}
+
+type fakeMessenger struct {
+	mu   sync.Mutex
+	sent []sentMessage
+	fail int // number of sends to fail before succeeding
+}
+
+func (m *fakeMessenger) SendText(ctx context.Context, chatID string, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.fail > 0 {
+		m.fail--
+		return errors.New("network down")
+	}
+
+	m.sent = append(m.sent, sentMessage{chatID, text})
+	return nil
+}
+
+func (m *fakeMessenger) SendReply(ctx context.Context, msg chat.Message, text string) error {
+	return m.SendText(ctx, msg.Chat, text)
+}
+
+func (m *fakeMessenger) React(ctx context.Context, msg chat.Message, emoji string) error {
+	return nil
+}
+
+func (m *fakeMessenger) ResolveChat(ctx context.Context, name string) (string, error) {
+	return name, nil
+}
+
+// fakeStore implements the parts of store.Store the deadline manager uses.
+type fakeStore struct {
+	store.Store
+
+	mu       sync.Mutex
+	clock    Clock
+	due      []store.Deadline
+	updated  map[int]int
+	deleted  []int
+	advanced map[int]time.Time
+	changes  chan struct{}
+
+	outbox        []*fakeOutboxEntry
+	nextMessageID int
+	failMarks     int // number of MarkDelivered calls to fail
+	failApplies   int // number of ApplyDeadlineChanges calls to fail
+	prunedBefore  []time.Time
+}
+
+type fakeOutboxEntry struct {
+	msg         store.OutboxMessage
+	nextAttempt time.Time
+	status      string
+}
+
+func newFakeStore(due ...store.Deadline) *fakeStore {
+	return &fakeStore{
+		clock:    realClock{},
+		due:      due,
+		updated:  map[int]int{},
+		advanced: map[int]time.Time{},
+		changes:  make(chan struct{}, 1),
+	}
+}
+
+func (s *fakeStore) isDeleted(id int) bool {
+	return slices.Contains(s.deleted, id)
+}
+
+func (s *fakeStore) Timezone() *time.Location {
+	return time.UTC
+}
+
+func (s *fakeStore) ListDueDeadlines(ctx context.Context, groups []string, now time.Time) ([]store.Deadline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []store.Deadline
+	for _, d := range s.due {
+		if !s.isDeleted(d.ID) && !d.NextReminder.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) NextReminderAt(ctx context.Context, groups []string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, d := range s.due {
+		if !s.isDeleted(d.ID) && (!found || d.NextReminder.Before(next)) {
+			next, found = d.NextReminder, true
+		}
+	}
+	return next, found, nil
+}
+
+func (s *fakeStore) Changes() <-chan struct{} {
+	return s.changes
+}
+
+func (s *fakeStore) ApplyDeadlineChanges(ctx context.Context, changes []store.DeadlineChange, messages []store.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failApplies > 0 {
+		s.failApplies--
+		return errors.New("database is locked")
+	}
+
+	find := func(id int) int {
+		return slices.IndexFunc(s.due, func(d store.Deadline) bool { return d.ID == id })
+	}
+
+	for _, c := range changes {
+		i := find(c.From.ID)
+		if i < 0 || s.isDeleted(c.From.ID) ||
+			!s.due[i].NextReminder.Equal(c.From.NextReminder) ||
+			s.due[i].NextRemindIndex != c.From.NextRemindIndex {
+			return store.ErrStaleDeadline
+		}
+	}
+
+	for _, c := range changes {
+		i := find(c.From.ID)
+
+		if c.Delete {
+			s.deleted = append(s.deleted, c.From.ID)
+			continue
+		}
+
+		if !c.DueAt.IsZero() {
+			s.advanced[c.From.ID] = c.DueAt
+			s.due[i].DueAt = c.DueAt
+		}
+
+		s.updated[c.From.ID] = c.NextRemindIndex
+		s.due[i].NextReminder = c.NextReminder
+		s.due[i].NextRemindIndex = c.NextRemindIndex
+	}
+
+	now := s.clock.Now()
+	for _, m := range messages {
+		s.nextMessageID++
+		m.ID = s.nextMessageID
+		m.Key = fmt.Sprintf("key%d", m.ID)
+		m.CreatedAt = now
+		s.outbox = append(s.outbox, &fakeOutboxEntry{msg: m, nextAttempt: now, status: "pending"})
+	}
+
+	return nil
+}
+
+func (s *fakeStore) PendingMessages(ctx context.Context, chats []string, now time.Time) ([]store.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []store.OutboxMessage
+	for _, e := range s.outbox {
+		if e.status == "pending" && !e.nextAttempt.After(now) {
+			pending = append(pending, e.msg)
+		}
+	}
+	return pending, nil
+}
+
+func (s *fakeStore) NextDeliveryAt(ctx context.Context, chats []string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, e := range s.outbox {
+		if e.status == "pending" && (!found || e.nextAttempt.Before(next)) {
+			next, found = e.nextAttempt, true
+		}
+	}
+	return next, found, nil
+}
+
+func (s *fakeStore) MarkDelivered(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failMarks > 0 {
+		s.failMarks--
+		return errors.New("database is locked")
+	}
+
+	s.outbox[id-1].status = "delivered"
+	return nil
+}
+
+func (s *fakeStore) MarkFailed(ctx context.Context, id int, reason string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.outbox[id-1]
+	e.msg.Attempts++
+	if retryAt.IsZero() {
+		e.status = "dropped"
+	} else {
+		e.nextAttempt = retryAt
+	}
+	return nil
+}
+
+func (s *fakeStore) PruneOutbox(ctx context.Context, chats []string, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prunedBefore = append(s.prunedBefore, cutoff)
+	return 0, nil
+}
+
+// add inserts a deadline and signals the change like a real store would.
+func (s *fakeStore) add(d store.Deadline) {
+	s.mu.Lock()
+	s.due = append(s.due, d)
+	s.mu.Unlock()
+
+	s.changes <- struct{}{}
+}
+
+func TestRunChecksSendsReminder(t *testing.T) {
+	now := time.Now().UTC()
+	schedule := []time.Duration{time.Hour, 3 * time.Hour}
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "lab",
+		DueAt:           now.Add(3 * time.Hour),
+		NextReminder:    now.Add(-time.Minute),
+		NextRemindIndex: 1,
+		Reminders:       schedule,
+	})
+	m := &fakeMessenger{}
+
+	dm := DeadlineManager{Messenger: m, Store: s, CatchUp: CatchUpSummary}
+	dm.runChecks(context.Background())
+	dm.deliver(context.Background())
+
+	if len(m.sent) != 1 || !strings.Contains(m.sent[0].text, "*REMINDER*") || m.sent[0].chat != "g1" {
+		t.Fatalf("sent = %+v, want one reminder to g1", m.sent)
+	}
+
+	if s.updated[1] != 0 {
+		t.Fatalf("next index = %d, want 0", s.updated[1])
+	}
+}
+
+func TestRunChecksCatchesUpAfterDowntime(t *testing.T) {
+	now := time.Now().UTC()
+	schedule := []time.Duration{time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour}
+
+	s := newFakeStore(
+		// The 12h and 6h reminders were missed, the 3h one is still ahead.
+		store.Deadline{
+			ID:              1,
+			GroupID:         "g1",
+			Title:           "exam",
+			DueAt:           now.Add(4 * time.Hour),
+			NextReminder:    now.Add(-8 * time.Hour),
+			NextRemindIndex: 3,
+			Reminders:       schedule,
+		},
+		// Expired while offline.
+		store.Deadline{
+			ID:              2,
+			GroupID:         "g1",
+			Title:           "quiz",
+			DueAt:           now.Add(-2 * time.Hour),
+			NextReminder:    now.Add(-3 * time.Hour),
+			NextRemindIndex: 0,
+			Reminders:       schedule,
+		},
+		// Expired while offline but repeats.
+		store.Deadline{
+			ID:              3,
+			GroupID:         "g2",
+			Title:           "standup",
+			DueAt:           now.Add(-2 * time.Hour),
+			NextReminder:    now.Add(-2 * time.Hour),
+			NextRemindIndex: -1,
+			Reminders:       schedule,
+			Recurrence:      store.Recurrence{Days: 1},
+		},
+	)
+	m := &fakeMessenger{}
+	standupDue := s.due[2].DueAt
+
+	dm := DeadlineManager{Messenger: m, Store: s, CatchUp: CatchUpSummary}
+	dm.runChecks(context.Background())
+	dm.deliver(context.Background())
+
+	if s.updated[1] != 1 {
+		t.Fatalf("deadline 1 next index = %d, want 1", s.updated[1])
+	}
+
+	if len(s.deleted) != 1 || s.deleted[0] != 2 {
+		t.Fatalf("deleted = %v, want [2]", s.deleted)
+	}
+
+	if want := standupDue.AddDate(0, 0, 1); !s.advanced[3].Equal(want) {
+		t.Fatalf("deadline 3 advanced to %v, want %v", s.advanced[3], want)
+	}
+
+	if len(m.sent) != 2 {
+		t.Fatalf("sent %d messages, want one summary per group: %+v", len(m.sent), m.sent)
+	}
+
+	for _, msg := range m.sent {
+		if !strings.HasPrefix(msg.text, "*WHILE I WAS OFFLINE*") {
+			t.Fatalf("unexpected message %q", msg.text)
+		}
+	}
+
+	if g1 := m.sent[0].text; !strings.Contains(g1, "exam") || !strings.Contains(g1, "quiz") {
+		t.Fatalf("g1 summary %q should mention exam and quiz", g1)
+	}
+}
+
+func TestRunChecksSkipPolicyIsSilent(t *testing.T) {
+	now := time.Now().UTC()
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "exam",
+		DueAt:           now.Add(30 * time.Minute),
+		NextReminder:    now.Add(-5 * time.Hour),
+		NextRemindIndex: 1,
+		Reminders:       []time.Duration{time.Hour, 6 * time.Hour},
+	})
+	m := &fakeMessenger{}
+
+	dm := DeadlineManager{Messenger: m, Store: s, CatchUp: CatchUpSkip}
+	dm.runChecks(context.Background())
+	dm.deliver(context.Background())
+
+	if len(m.sent) != 0 {
+		t.Fatalf("sent = %+v, want nothing", m.sent)
+	}
+
+	if s.updated[1] != -1 {
+		t.Fatalf("next index = %d, want -1", s.updated[1])
+	}
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return true
+}
+
+// fakeClock only moves when told to. Every timer it hands out is reported on
+// timers, which tells a test that the manager has gone to sleep.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers chan *fakeTimer
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, timers: make(chan *fakeTimer, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers <- t
+	return t
+}
+
+// Fire moves the clock to the timer's deadline and fires it.
+func (c *fakeClock) Fire(t *fakeTimer) {
+	c.mu.Lock()
+	c.now = t.at
+	c.mu.Unlock()
+
+	t.c <- t.at
+}
+
+func nextTimer(t *testing.T, c *fakeClock) *fakeTimer {
+	t.Helper()
+
+	select {
+	case timer := <-c.timers:
+		return timer
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadline manager never went to sleep")
+		return nil
+	}
+}
+
+func TestStartSleepsUntilNextReminder(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "lab",
+		DueAt:           start.Add(50 * time.Minute),
+		NextReminder:    start.Add(30 * time.Minute),
+		NextRemindIndex: 0,
+		Reminders:       []time.Duration{20 * time.Minute},
+	})
+	s.clock = clock
+	m := &fakeMessenger{}
+
+	dm := DeadlineManager{Messenger: m, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	timer := nextTimer(t, clock)
+	if want := start.Add(30 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("slept until %v, want %v", timer.at, want)
+	}
+
+	clock.Fire(timer)
+
+	// After the reminder the manager sleeps until expiry.
+	timer = nextTimer(t, clock)
+	if want := start.Add(50 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("slept until %v, want %v", timer.at, want)
+	}
+
+	m.mu.Lock()
+	sent := slices.Clone(m.sent)
+	m.mu.Unlock()
+
+	if len(sent) != 1 || !strings.Contains(sent[0].text, "It is due in *20 minutes*") {
+		t.Fatalf("sent = %+v, want one on-time reminder", sent)
+	}
+}
+
+func TestStartWakesOnStoreChange(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := newFakeStore()
+
+	dm := DeadlineManager{Messenger: &fakeMessenger{}, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	timer := nextTimer(t, clock)
+	if want := start.Add(maxSleep); !timer.at.Equal(want) {
+		t.Fatalf("idle sleep until %v, want %v", timer.at, want)
+	}
+
+	s.add(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "quiz",
+		DueAt:           start.Add(10 * time.Minute),
+		NextReminder:    start.Add(10 * time.Minute),
+		NextRemindIndex: -1,
+	})
+
+	timer = nextTimer(t, clock)
+	if want := start.Add(10 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("after change slept until %v, want %v", timer.at, want)
+	}
+}
+
+func TestStartPrunesOutboxHourly(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := newFakeStore()
+
+	dm := DeadlineManager{Messenger: &fakeMessenger{}, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	nextTimer(t, clock)
+
+	// A wake within the hour does not prune again.
+	s.changes <- struct{}{}
+	clock.Fire(nextTimer(t, clock))
+	nextTimer(t, clock)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := []time.Time{start.Add(-maxMessageAge), start.Add(time.Hour - maxMessageAge)}
+	if !slices.EqualFunc(s.prunedBefore, want, time.Time.Equal) {
+		t.Fatalf("pruned before %v, want %v", s.prunedBefore, want)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "lab",
+		DueAt:           start.Add(50 * time.Minute),
+		NextReminder:    start,
+		NextRemindIndex: 0,
+		Reminders:       []time.Duration{50 * time.Minute},
+	})
+	s.clock = clock
+	m := &fakeMessenger{fail: 2}
+
+	dm := DeadlineManager{Messenger: m, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	// The reminder is handled once, then its delivery is retried after 10s
+	// and 20s.
+	for _, delay := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		timer := nextTimer(t, clock)
+		if want := clock.Now().Add(delay); !timer.at.Equal(want) {
+			t.Fatalf("retry at %v, want %v", timer.at, want)
+		}
+		clock.Fire(timer)
+	}
+
+	timer := nextTimer(t, clock)
+	if want := start.Add(50 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("after delivery slept until %v, want expiry at %v", timer.at, want)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) != 1 {
+		t.Fatalf("sent %d messages, want the reminder exactly once", len(m.sent))
+	}
+}
+
+func TestDeliverDoesNotResendUnmarkedMessage(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "lab",
+		DueAt:           start.Add(50 * time.Minute),
+		NextReminder:    start,
+		NextRemindIndex: 0,
+		Reminders:       []time.Duration{50 * time.Minute},
+	})
+	s.clock = clock
+	s.failMarks = 1
+	m := &fakeMessenger{}
+
+	dm := DeadlineManager{Messenger: m, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	// The reminder is sent but can't be marked delivered, so the manager
+	// backs off and then only marks it.
+	timer := nextTimer(t, clock)
+	if want := start.Add(retryDelay(1)); !timer.at.Equal(want) {
+		t.Fatalf("slept until %v, want %v", timer.at, want)
+	}
+	clock.Fire(timer)
+
+	timer = nextTimer(t, clock)
+	if want := start.Add(50 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("after marking slept until %v, want expiry at %v", timer.at, want)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) != 1 {
+		t.Fatalf("sent %d messages, want the reminder exactly once", len(m.sent))
+	}
+}
+
+func TestStartBacksOffWhenSavingFails(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	s := newFakeStore(store.Deadline{
+		ID:              1,
+		GroupID:         "g1",
+		Title:           "lab",
+		DueAt:           start.Add(50 * time.Minute),
+		NextReminder:    start,
+		NextRemindIndex: 0,
+		Reminders:       []time.Duration{50 * time.Minute},
+	})
+	s.clock = clock
+	s.failApplies = 1
+	m := &fakeMessenger{}
+
+	dm := DeadlineManager{Messenger: m, Store: s, Clock: clock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dm.Start(ctx)
+
+	// The reminder is still due, but the manager waits before trying again.
+	timer := nextTimer(t, clock)
+	if want := start.Add(retryDelay(1)); !timer.at.Equal(want) {
+		t.Fatalf("slept until %v, want %v", timer.at, want)
+	}
+	clock.Fire(timer)
+
+	timer = nextTimer(t, clock)
+	if want := start.Add(50 * time.Minute); !timer.at.Equal(want) {
+		t.Fatalf("after saving slept until %v, want expiry at %v", timer.at, want)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sent) != 1 {
+		t.Fatalf("sent %d messages, want the reminder once", len(m.sent))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{7, 640 * time.Second},
+		{8, retryMax},
+		{100, retryMax},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package job
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/media"
+	"github.com/kaezrr/remy-bot/internal/store"
+	"github.com/rs/zerolog/log"
+)
+
+// How often the trash is checked for baskets past their retention.
+const purgeInterval = time.Hour
+
+// Files are only deleted once they were stored this long ago, so one saved
+// for a pin that is still being added is kept.
+const mediaGrace = time.Hour
+
+// TrashPurger deletes baskets for good once they have been in the trash
+// longer than Retention, and then the files no pin refers to anymore.
+type TrashPurger struct {
+	Store     store.Store
+	Retention time.Duration
+	Media     media.Dir // where pin files are kept, empty to leave them
+	Clock     Clock     // defaults to the system clock
+
+	// Groups limits the purger to these groups, as with
+	// DeadlineManager.Groups.
+	Groups []string
+}
+
+// Start purges the trash now and then every purgeInterval until ctx is
+// cancelled.
+func (tp *TrashPurger) Start(ctx context.Context) {
+	clock := tp.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	for {
+		tp.purge(ctx, clock.Now())
+
+		timer := clock.NewTimer(purgeInterval)
+
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (tp *TrashPurger) purge(ctx context.Context, now time.Time) {
+	n, err := tp.Store.PurgeTrash(ctx, tp.Groups, now.Add(-tp.Retention))
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to purge trash")
+		return
+	}
+
+	if n > 0 {
+		log.Info().Int("baskets", n).Msg("Job: purged baskets from the trash")
+	}
+
+	if tp.Media != "" {
+		tp.sweep(ctx, now)
+	}
+}
+
+// sweep deletes the files of pins that were deleted or purged.
+func (tp *TrashPurger) sweep(ctx context.Context, now time.Time) {
+	sums, err := tp.Store.MediaInUse(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to list pin files")
+		return
+	}
+
+	n, err := tp.Media.Sweep(func(sum string) bool { return slices.Contains(sums, sum) }, now.Add(-mediaGrace))
+	if err != nil {
+		log.Error().Err(err).Msg("Job: failed to delete unused pin files")
+	}
+
+	if n > 0 {
+		log.Info().Int("files", n).Msg("Job: deleted unused pin files")
+	}
+}
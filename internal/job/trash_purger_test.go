@@ -0,0 +1,82 @@
+package job
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/media"
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+type purgeCall struct {
+	groups []string
+	cutoff time.Time
+}
+
+type purgeStore struct {
+	store.Store
+	calls chan purgeCall
+	inUse []string
+}
+
+func (s *purgeStore) MediaInUse(ctx context.Context) ([]string, error) {
+	return s.inUse, nil
+}
+
+func (s *purgeStore) PurgeTrash(ctx context.Context, groups []string, cutoff time.Time) (int, error) {
+	s.calls <- purgeCall{groups, cutoff}
+	return 0, nil
+}
+
+func TestTrashPurgerPurgesHourly(t *testing.T) {
+	start := time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s := &purgeStore{calls: make(chan purgeCall, 4)}
+
+	tp := TrashPurger{Store: s, Retention: 30 * 24 * time.Hour, Clock: clock, Groups: []string{"g1"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tp.Start(ctx)
+
+	call := <-s.calls
+	if want := start.Add(-30 * 24 * time.Hour); !call.cutoff.Equal(want) || !slices.Equal(call.groups, []string{"g1"}) {
+		t.Fatalf("PurgeTrash(%v, %v), want (%v, [g1])", call.groups, call.cutoff, want)
+	}
+
+	timer := nextTimer(t, clock)
+	if want := start.Add(time.Hour); !timer.at.Equal(want) {
+		t.Fatalf("slept until %v, want %v", timer.at, want)
+	}
+	clock.Fire(timer)
+
+	call = <-s.calls
+	if want := start.Add(time.Hour - 30*24*time.Hour); !call.cutoff.Equal(want) {
+		t.Fatalf("second cutoff = %v, want %v", call.cutoff, want)
+	}
+}
+
+func TestTrashPurgerDeletesUnusedFiles(t *testing.T) {
+	dir := media.Dir(t.TempDir())
+	kept, _ := dir.Put([]byte("timetable"))
+	unused, _ := dir.Put([]byte("old slides"))
+
+	s := &purgeStore{calls: make(chan purgeCall, 2), inUse: []string{kept}}
+	tp := TrashPurger{Store: s, Media: dir}
+
+	// Both files are new, so they are kept for now.
+	tp.purge(context.Background(), time.Now())
+	if _, err := dir.Read(unused); err != nil {
+		t.Fatalf("a new file was deleted: %v", err)
+	}
+
+	tp.purge(context.Background(), time.Now().Add(2*mediaGrace))
+	if _, err := dir.Read(unused); err != media.ErrNotFound {
+		t.Errorf("Read of the unused file = %v, want ErrNotFound", err)
+	}
+	if _, err := dir.Read(kept); err != nil {
+		t.Errorf("Read of the pinned file = %v", err)
+	}
+}
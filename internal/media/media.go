@@ -0,0 +1,116 @@
+// Package media keeps the files attached to pins.
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned by Read for a file that is not in the directory.
+var ErrNotFound = errors.New("attachment not found")
+
+// Dir is a content-addressed directory: every file is named after the
+// SHA-256 of its content, so the same file pinned twice is stored once.
+// Files live in subdirectories named after the first two hex digits of
+// their hash, to keep directories small.
+type Dir string
+
+// Put stores data and returns its SHA-256 as hex.
+func (d Dir) Put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+
+	path := d.path(name)
+	if _, err := os.Stat(path); err == nil {
+		// Touch it, so Sweep leaves it alone until it is pinned again.
+		now := time.Now()
+		return name, os.Chtimes(path, now, now)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated
+	// file under the final name.
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// Read returns the file with SHA-256 sum.
+func (d Dir) Read(sum string) ([]byte, error) {
+	if !validSum(sum) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(d.path(sum))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Sweep deletes the files for which inUse is false, unless they were stored
+// at or after before. It returns how many files it deleted.
+func (d Dir) Sweep(inUse func(sum string) bool, before time.Time) (int, error) {
+	files, err := filepath.Glob(filepath.Join(string(d), "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, path := range files {
+		sum := filepath.Base(path)
+		if !validSum(sum) || inUse(sum) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func (d Dir) path(sum string) string {
+	return filepath.Join(string(d), sum[:2], sum)
+}
+
+// validSum reports whether sum looks like a hex SHA-256, so it can't be used
+// to reach outside the directory.
+func validSum(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
@@ -0,0 +1,79 @@
+package media
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	d := Dir(t.TempDir())
+
+	sum, err := d.Put([]byte("timetable"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	again, err := d.Put([]byte("timetable"))
+	if err != nil || again != sum {
+		t.Errorf("Put of the same data = %q, %v; want %q", again, err, sum)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(string(d), sum[:2]))
+	if len(entries) != 1 {
+		t.Errorf("%d files stored, want 1", len(entries))
+	}
+
+	data, err := d.Read(sum)
+	if err != nil || !bytes.Equal(data, []byte("timetable")) {
+		t.Errorf("Read = %q, %v", data, err)
+	}
+
+	for _, bad := range []string{"", "../../etc/passwd", sum[:10], "zz" + sum[2:]} {
+		if _, err := d.Read(bad); err != ErrNotFound {
+			t.Errorf("Read(%q) = %v, want ErrNotFound", bad, err)
+		}
+	}
+
+	other := "0000000000000000000000000000000000000000000000000000000000000000"
+	if _, err := d.Read(other); err != ErrNotFound {
+		t.Errorf("Read of a missing file = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	d := Dir(t.TempDir())
+
+	kept, _ := d.Put([]byte("kept"))
+	unused, _ := d.Put([]byte("unused"))
+	recent, _ := d.Put([]byte("recent"))
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, sum := range []string{kept, unused} {
+		if err := os.Chtimes(d.path(sum), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := d.Sweep(func(sum string) bool { return sum == kept }, time.Now().Add(-time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v; want 1", n, err)
+	}
+
+	for sum, want := range map[string]error{kept: nil, unused: ErrNotFound, recent: nil} {
+		if _, err := d.Read(sum); err != want {
+			t.Errorf("Read after Sweep = %v, want %v", err, want)
+		}
+	}
+
+	// Storing a file again protects it from the next sweep.
+	if err := os.Chtimes(d.path(recent), old, old); err != nil {
+		t.Fatal(err)
+	}
+	d.Put([]byte("recent"))
+	if n, _ := d.Sweep(func(string) bool { return false }, time.Now().Add(-time.Hour)); n != 1 {
+		t.Errorf("Sweep after Put = %d, want only the old kept file", n)
+	}
+}
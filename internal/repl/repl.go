@@ -0,0 +1,243 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/app"
+	"github.com/kaezrr/remy-bot/internal/chat"
+	"github.com/kaezrr/remy-bot/internal/config"
+	"github.com/kaezrr/remy-bot/internal/job"
+	"github.com/kaezrr/remy-bot/internal/media"
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+const prompt = "> "
+
+// Messenger is a chat.Messenger that prints everything it is asked to send
+// to a terminal.
+type Messenger struct {
+	mu  sync.Mutex
+	out io.Writer
+
+	// replying is set while a line is handled, so that what is sent then
+	// prints as the reply to it.
+	replying bool
+}
+
+func NewMessenger(out io.Writer) *Messenger {
+	return &Messenger{out: out}
+}
+
+func (m *Messenger) SendText(ctx context.Context, chatID string, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.replying {
+		_, err := fmt.Fprintln(m.out, text)
+		return err
+	}
+
+	// Messages sent outside a reply (reminders, announcements) can arrive while
+	// the user is typing, so start on a fresh line and restore the prompt.
+	_, err := fmt.Fprintf(m.out, "\n[%s] %s\n%s", chatID, text, prompt)
+	return err
+}
+
+func (m *Messenger) SendReply(ctx context.Context, msg chat.Message, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintln(m.out, text)
+	return err
+}
+
+// SendMedia prints a description of the file instead of the file itself.
+func (m *Messenger) SendMedia(ctx context.Context, chatID string, file chat.File, caption string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	desc := file.Kind
+	if file.Name != "" {
+		desc += " " + file.Name
+	}
+
+	_, err := fmt.Fprintf(m.out, "[sent %s, %d bytes] %s\n", desc, len(file.Data), caption)
+	return err
+}
+
+func (m *Messenger) React(ctx context.Context, msg chat.Message, emoji string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "(reacted %s)\n", emoji)
+	return err
+}
+
+// IsAdmin treats everyone as a group admin, so every command can be tried
+// out. Roles given with .role still apply.
+func (m *Messenger) IsAdmin(ctx context.Context, chatID string, user string) (bool, error) {
+	return true, nil
+}
+
+// ResolveChat treats every name as an existing chat whose identifier is the
+// name itself.
+func (m *Messenger) ResolveChat(ctx context.Context, name string) (string, error) {
+	return name, nil
+}
+
+// reply runs handle with what is sent meanwhile printed as replies.
+func (m *Messenger) reply(handle func()) {
+	m.mu.Lock()
+	m.replying = true
+	m.mu.Unlock()
+
+	handle()
+
+	m.mu.Lock()
+	m.replying = false
+	m.mu.Unlock()
+}
+
+func (m *Messenger) prompt() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprint(m.out, prompt)
+}
+
+var (
+	_ chat.Messenger    = (*Messenger)(nil)
+	_ chat.MediaSender  = (*Messenger)(nil)
+	_ chat.AdminChecker = (*Messenger)(nil)
+)
+
+// attach returns a local file as an attachment. The kind of file is guessed
+// from its extension.
+func attach(path string) (*chat.Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	kind := "document"
+	for _, k := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(mimeType, k+"/") {
+			kind = k
+		}
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	return &chat.Attachment{
+		Kind: kind,
+		MIME: mimeType,
+		Name: filepath.Base(path),
+		Size: info.Size(),
+		Download: func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}, nil
+}
+
+// Run reads commands line by line from in as if they were sent to group and
+// writes the bot's replies to out. Deadline reminders are delivered to out as
+// they fire. Run returns when in is exhausted.
+func Run(cfg *config.Config, s store.Store, handle app.HandleFunc, group string, in io.Reader, out io.Writer) error {
+	messenger := NewMessenger(out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := job.DeadlineManager{
+		Messenger: messenger,
+		Store:     s,
+		CatchUp:   job.CatchUpPolicy(cfg.MissedReminders),
+		Groups:    []string{group},
+	}
+	go manager.Start(ctx)
+
+	purger := job.TrashPurger{
+		Store:     s,
+		Retention: cfg.TrashRetention(),
+		Media:     media.Dir(cfg.MediaDir),
+		Groups:    []string{group},
+	}
+	go purger.Start(ctx)
+
+	dispatcher := app.Dispatcher{
+		Messenger: messenger,
+		Store:     s,
+		Handle:    handle,
+		Prefix:    cfg.Prefix,
+		Chats:     map[string]bool{group: true},
+		Media:     media.Dir(cfg.MediaDir),
+	}
+
+	fmt.Fprintf(out, "Remy REPL, chatting as %q. Type %sh for help, >N to reply to your Nth line, file:PATH to attach a file, Ctrl-D to quit.\n", group, cfg.Prefix)
+
+	var history []chat.Message
+
+	scanner := bufio.NewScanner(in)
+	for n := 1; ; n++ {
+		messenger.prompt()
+
+		if !scanner.Scan() {
+			break
+		}
+
+		msg := chat.Message{
+			ID:         strconv.Itoa(n),
+			Chat:       group,
+			Sender:     "repl",
+			SenderName: "You",
+			Text:       scanner.Text(),
+			Time:       time.Now(),
+		}
+
+		// ">3 .p add notes" replies to the third line.
+		if ref, text, ok := strings.Cut(msg.Text, " "); ok && strings.HasPrefix(ref, ">") {
+			i, err := strconv.Atoi(ref[1:])
+			if err != nil || i < 1 || i > len(history) {
+				fmt.Fprintf(out, "no line %s to reply to\n", ref[1:])
+				history = append(history, msg)
+				continue
+			}
+
+			quoted := history[i-1]
+			quoted.Quoted = nil
+			msg.Text, msg.Quoted = text, &quoted
+		}
+
+		// "file:slides.pdf .p add notes" sends the command as the caption of
+		// a file.
+		if ref, text, ok := strings.Cut(msg.Text, " "); ok && strings.HasPrefix(ref, "file:") {
+			a, err := attach(ref[len("file:"):])
+			if err != nil {
+				fmt.Fprintln(out, err)
+				history = append(history, msg)
+				continue
+			}
+
+			msg.Text, msg.Attachment = text, a
+		}
+
+		history = append(history, msg)
+		messenger.reply(func() { dispatcher.Dispatch(msg) })
+	}
+
+	fmt.Fprintln(out)
+
+	return scanner.Err()
+}
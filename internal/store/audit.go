@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AuditEntry records a change a command made to a deadline, basket, pin or
+// role.
+type AuditEntry struct {
+	ID      int
+	Actor   string // who ran the command, without server or device
+	Command string // such as "p edit"
+	Entity  string // deadline, basket, pin or role
+	Target  string // ID or name of the entity
+	// Before and After are JSON snapshots of the entity. Before is empty
+	// for additions and After for deletions.
+	Before string
+	After  string
+	At     time.Time
+}
+
+// changed reports whether e records a change, rather than the same snapshot
+// before and after.
+func (e AuditEntry) changed() bool {
+	return e.Before == "" || e.Before != e.After
+}
+
+func (dbs *DBStore) AddAuditEntry(ctx context.Context, group string, entry AuditEntry) (AuditEntry, error) {
+	const query = `
+		INSERT INTO audit_log (
+			group_id,
+			actor,
+			command,
+			entity,
+			target,
+			before_json,
+			after_json,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id;
+	`
+
+	entry.At = time.Now().UTC().Truncate(time.Second)
+
+	err := dbs.db.QueryRowContext(
+		ctx,
+		query,
+		group,
+		entry.Actor,
+		entry.Command,
+		entry.Entity,
+		entry.Target,
+		entry.Before,
+		entry.After,
+		formatTime(entry.At),
+	).Scan(&entry.ID)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// auditRetries is how many more times WithAudit runs a change that Postgres
+// could not serialize with a concurrent one.
+const auditRetries = 3
+
+func (dbs *DBStore) WithAudit(ctx context.Context, group string, change func(s Store) (AuditEntry, error)) error {
+	for retries := 0; ; retries++ {
+		err := dbs.withAudit(ctx, group, change)
+		if retries == auditRetries || !isSerializationFailure(err) {
+			return err
+		}
+	}
+}
+
+func (dbs *DBStore) withAudit(ctx context.Context, group string, change func(s Store) (AuditEntry, error)) error {
+	var opts *sql.TxOptions
+	if dbs.driver == Postgres {
+		// So that nothing change reads, such as the entity as it was before,
+		// is changed by someone else before it commits. SQLite transactions
+		// hold the write lock throughout already.
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+
+	tx, err := dbs.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var changed bool
+	inTx := &DBStore{
+		db:        tx,
+		driver:    dbs.driver,
+		timezone:  dbs.timezone,
+		reminders: dbs.reminders,
+		changes:   dbs.changes,
+		changed:   &changed,
+	}
+
+	entry, err := change(inTx)
+	if err != nil {
+		return err
+	}
+
+	if entry.changed() {
+		if _, err := inTx.AddAuditEntry(ctx, group, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if changed {
+		dbs.notify()
+	}
+
+	return nil
+}
+
+func (dbs *DBStore) ListAuditEntries(ctx context.Context, group string, limit int) ([]AuditEntry, error) {
+	const query = `
+		SELECT id, actor, command, entity, target, before_json, after_json, created_at
+		FROM audit_log
+		WHERE group_id = ?
+		ORDER BY id DESC
+		LIMIT ?;`
+
+	rows, err := dbs.db.QueryContext(ctx, query, group, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+
+	for rows.Next() {
+		var (
+			e     AuditEntry
+			atStr string
+		)
+
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Command, &e.Entity, &e.Target, &e.Before, &e.After, &atStr); err != nil {
+			return nil, err
+		}
+
+		if e.At, err = parseTime(atStr); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
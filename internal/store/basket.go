@@ -2,47 +2,121 @@ package store
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"strings"
+	"time"
 )
 
-func (dbs *DBStore) AddBasket(ctx context.Context, name string) error {
+func (dbs *DBStore) AddBasket(ctx context.Context, group string, name string) error {
 	const query = `
-		INSERT INTO baskets (name)
-		VALUES (?);`
+		INSERT INTO baskets (group_id, name)
+		VALUES (?, ?);`
 
-	_, err := dbs.db.ExecContext(ctx, query, strings.ToLower(name))
+	// Checked first, as on Postgres nothing more can be done in a transaction
+	// once a write has failed.
+	if err := dbs.nameTaken(ctx, group, name); err != nil {
+		return err
+	}
+
+	_, err := dbs.db.ExecContext(ctx, query, group, strings.ToLower(name))
+	if err != nil && isUniqueViolation(err) {
+		// Taken since it was checked.
+		return ErrBasketExists
+	}
+	return err
+}
+
+func (dbs *DBStore) ListBaskets(ctx context.Context, group string) ([]Basket, error) {
+	const query = `
+		SELECT b.name, b.description, COUNT(p.id)
+		FROM baskets b
+		LEFT JOIN pins p ON p.basket_id = b.id
+		WHERE b.group_id = ? AND b.deleted_at = ''
+		GROUP BY b.id, b.name, b.description
+		ORDER BY b.name ASC;`
+
+	rows, err := dbs.db.QueryContext(ctx, query, group)
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return errors.New("basket already exists")
+		return nil, err
+	}
+	defer rows.Close()
+
+	baskets := []Basket{}
+
+	for rows.Next() {
+		var b Basket
+
+		if err := rows.Scan(&b.Name, &b.Description, &b.Pins); err != nil {
+			return nil, err
 		}
+
+		baskets = append(baskets, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return baskets, nil
+}
+
+func (dbs *DBStore) DeleteBasket(ctx context.Context, group string, name string) error {
+	const query = `
+		UPDATE baskets SET deleted_at = ?
+		WHERE group_id = ? AND name = ? AND deleted_at = '';`
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	res, err := dbs.db.ExecContext(ctx, query, now, group, strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
 
+	if count == 0 {
+		return ErrBasketNotFound
+	}
+
 	return nil
 }
 
-func (dbs *DBStore) ListBaskets(ctx context.Context) ([]string, error) {
+func (dbs *DBStore) ListTrash(ctx context.Context, group string) ([]Basket, error) {
 	const query = `
-		SELECT name FROM baskets
-		ORDER BY name ASC;`
-
-	rows, err := dbs.db.QueryContext(ctx, query)
+		SELECT b.name, b.description, COUNT(p.id), b.deleted_at
+		FROM baskets b
+		LEFT JOIN pins p ON p.basket_id = b.id
+		WHERE b.group_id = ? AND b.deleted_at != ''
+		GROUP BY b.id, b.name, b.description, b.deleted_at
+		ORDER BY b.deleted_at DESC, b.name ASC;`
+
+	rows, err := dbs.db.QueryContext(ctx, query, group)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	baskets := []string{}
+	baskets := []Basket{}
 
 	for rows.Next() {
-		var s string
+		var (
+			b            Basket
+			deletedAtStr string
+		)
+
+		if err := rows.Scan(&b.Name, &b.Description, &b.Pins, &deletedAtStr); err != nil {
+			return nil, err
+		}
 
-		if err := rows.Scan(&s); err != nil {
+		b.DeletedAt, err = time.Parse(time.RFC3339, deletedAtStr)
+		if err != nil {
 			return nil, err
 		}
 
-		baskets = append(baskets, s)
+		baskets = append(baskets, b)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -52,12 +126,78 @@ func (dbs *DBStore) ListBaskets(ctx context.Context) ([]string, error) {
 	return baskets, nil
 }
 
-func (dbs *DBStore) DeleteBasket(ctx context.Context, name string) error {
+func (dbs *DBStore) RestoreBasket(ctx context.Context, group string, name string) error {
 	const query = `
+		UPDATE baskets SET deleted_at = ''
+		WHERE group_id = ? AND name = ? AND deleted_at != '';`
+
+	res, err := dbs.db.ExecContext(ctx, query, group, strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotInTrash
+	}
+
+	return nil
+}
+
+// PurgeTrash relies on ON DELETE CASCADE to take the pins with the baskets.
+func (dbs *DBStore) PurgeTrash(ctx context.Context, groups []string, cutoff time.Time) (int, error) {
+	inGroup, args := inGroups("group_id", groups)
+
+	query := `
 		DELETE FROM baskets
-		WHERE name = ?;`
+		WHERE deleted_at != '' AND deleted_at < ? AND ` + inGroup + `;`
+
+	res, err := dbs.db.ExecContext(ctx, query, append([]any{cutoff.UTC().Format(time.RFC3339)}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+// RenameBasket only changes the name; pins refer to the basket by ID.
+func (dbs *DBStore) RenameBasket(ctx context.Context, group string, name string, newName string) error {
+	const query = `UPDATE baskets SET name = ? WHERE id = ?;`
+
+	id, err := dbs.basketID(ctx, group, name)
+	if err != nil {
+		return err
+	}
 
-	res, err := dbs.db.ExecContext(ctx, query, strings.ToLower(name))
+	// As in AddBasket, the name is checked before writing.
+	if !strings.EqualFold(name, newName) {
+		if err := dbs.nameTaken(ctx, group, newName); err != nil {
+			return err
+		}
+	}
+
+	_, err = dbs.db.ExecContext(ctx, query, strings.ToLower(newName), id)
+	if err != nil && isUniqueViolation(err) {
+		return ErrBasketExists
+	}
+	return err
+}
+
+func (dbs *DBStore) SetBasketDescription(ctx context.Context, group string, name string, description string) error {
+	const query = `
+		UPDATE baskets SET description = ?
+		WHERE group_id = ? AND name = ? AND deleted_at = '';`
+
+	res, err := dbs.db.ExecContext(ctx, query, description, group, strings.ToLower(name))
 	if err != nil {
 		return err
 	}
@@ -68,8 +208,44 @@ func (dbs *DBStore) DeleteBasket(ctx context.Context, name string) error {
 	}
 
 	if count == 0 {
-		return errors.New("basket does not exist")
+		return ErrBasketNotFound
 	}
 
 	return nil
 }
+
+// nameTaken tells why name can't be given to a basket of group, if another
+// basket has it, possibly one in the trash.
+func (dbs *DBStore) nameTaken(ctx context.Context, group string, name string) error {
+	const query = `SELECT deleted_at FROM baskets WHERE group_id = ? AND name = ?;`
+
+	var deletedAt string
+	err := dbs.db.QueryRowContext(ctx, query, group, strings.ToLower(name)).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if deletedAt != "" {
+		return ErrBasketInTrash
+	}
+	return ErrBasketExists
+}
+
+// basketID returns the ID of the basket called name in group.
+func (dbs *DBStore) basketID(ctx context.Context, group string, name string) (int, error) {
+	const query = `SELECT id FROM baskets WHERE group_id = ? AND name = ? AND deleted_at = '';`
+
+	var id int
+	err := dbs.db.QueryRowContext(ctx, query, group, strings.ToLower(name)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrBasketNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
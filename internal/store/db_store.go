@@ -1,78 +1,127 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"time"
 
 	"github.com/rs/zerolog/log"
-	_ "modernc.org/sqlite"
 )
 
+// DBStore keeps everything in a SQL database, either SQLite or Postgres.
 type DBStore struct {
-	db       *sql.DB
-	timezone *time.Location
+	db        querier
+	driver    string
+	timezone  *time.Location
+	reminders []time.Duration
+	changes   chan struct{}
+	// changed is set instead of signalling changes by the DBStore a WithAudit
+	// change is given, as they are not committed yet.
+	changed *bool
 }
 
-const CREATE_DEADLINES_TABLE = `
-CREATE TABLE IF NOT EXISTS deadlines(
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	title TEXT NOT NULL,
-	due_at TEXT NOT NULL,              -- RFC3339 UTC
-	next_reminder TEXT NOT NULL,       -- RFC3339 UTC
-	next_remind_index INTEGER NOT NULL,
-	CHECK (
-		(next_remind_index >= 0)
-		OR
-		(next_remind_index = -1 AND next_reminder = due_at)
-	)
-);`
-
-const CREATE_DEADLINES_INDEX = `
-CREATE INDEX IF NOT EXISTS idx_deadlines_next_reminder
-ON deadlines(next_reminder);`
-
-const CREATE_BASKETS_TABLE = `
-CREATE TABLE IF NOT EXISTS baskets(
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	name TEXT UNIQUE NOT NULL
-);`
-
-const CREATE_PINS_TABLE = `
-CREATE TABLE IF NOT EXISTS pins(
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	content TEXT NOT NULL,
-	basket_id INTEGER NOT NULL,
-	FOREIGN KEY(basket_id) REFERENCES baskets(id) 
-		ON DELETE CASCADE
-);`
-
-func mustExec(db *sql.DB, query string) {
-	if _, err := db.Exec(query); err != nil {
-		panic(err)
+// NewDBStore connects to a database with driver SQLite or Postgres and brings
+// its schema up to date. For SQLite dsn is the path of the database file. New
+// deadlines get the reminder schedule reminders unless given their own; nil
+// means DefaultReminderSchedule.
+func NewDBStore(driver, dsn string, timezone *time.Location, reminders []time.Duration) (*DBStore, error) {
+	if reminders == nil {
+		reminders = DefaultReminderSchedule
 	}
+
+	db, err := Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(context.Background(), db, driver); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Info().Str("driver", driver).Msg("connected to database!")
+
+	return &DBStore{
+		db:        &database{DB: db, driver: driver},
+		driver:    driver,
+		timezone:  timezone,
+		reminders: reminders,
+		changes:   make(chan struct{}, 1),
+	}, nil
 }
 
-func NewDBStore(path string, timezone *time.Location) (*DBStore, error) {
-	db, err := sql.Open("sqlite", path)
+// ClaimUnassigned moves deadlines and baskets created before groups existed
+// into group, returning how many it moved. Baskets whose name group already
+// uses stay unassigned. Only databases from then have such rows.
+func (dbs *DBStore) ClaimUnassigned(ctx context.Context, group string) (int, error) {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	res, err := tx.ExecContext(ctx, `UPDATE deadlines SET group_id = ? WHERE group_id = '';`, group)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	deadlines, _ := res.RowsAffected()
 
-	mustExec(db, "PRAGMA journal_mode = WAL;")
-	mustExec(db, "PRAGMA foreign_keys = ON;")
-	mustExec(db, CREATE_DEADLINES_TABLE)
-	mustExec(db, CREATE_BASKETS_TABLE)
-	mustExec(db, CREATE_PINS_TABLE)
-	mustExec(db, CREATE_DEADLINES_INDEX)
+	const basketQuery = `
+		UPDATE baskets SET group_id = ?
+		WHERE group_id = ''
+		AND name NOT IN (SELECT name FROM baskets WHERE group_id = ?);`
 
-	log.Info().Msg("connected to SQLite database!")
+	res, err = tx.ExecContext(ctx, basketQuery, group, group)
+	if err != nil {
+		return 0, err
+	}
+	baskets, _ := res.RowsAffected()
 
-	return &DBStore{db: db, timezone: timezone}, nil
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if deadlines > 0 {
+		dbs.notify()
+	}
+
+	return int(deadlines + baskets), nil
+}
+
+// CountUnassigned returns how many deadlines and baskets are in no group,
+// such as those ClaimUnassigned has yet to move.
+func (dbs *DBStore) CountUnassigned(ctx context.Context) (int, error) {
+	const query = `
+		SELECT
+			(SELECT COUNT(*) FROM deadlines WHERE group_id = '') +
+			(SELECT COUNT(*) FROM baskets WHERE group_id = '');`
+
+	var n int
+	if err := dbs.db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
 func (dbs *DBStore) Timezone() *time.Location {
 	return dbs.timezone
 }
 
+func (dbs *DBStore) Changes() <-chan struct{} {
+	return dbs.changes
+}
+
+// notify signals a change to deadlines without blocking. Changes made while a
+// signal is still pending are folded into it.
+func (dbs *DBStore) notify() {
+	if dbs.changed != nil {
+		*dbs.changed = true
+		return
+	}
+
+	select {
+	case dbs.changes <- struct{}{}:
+	default:
+	}
+}
+
 var _ Store = (*DBStore)(nil)
@@ -2,79 +2,161 @@ package store
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"time"
 )
 
-var ReminderSchedule = []time.Duration{
-	1 * time.Hour,
-	3 * time.Hour,
-	6 * time.Hour,
-	12 * time.Hour,
-	24 * time.Hour,
-	48 * time.Hour,
+const deadlineColumns = `
+	id, group_id, title, due_at, next_reminder, next_remind_index, reminders, recurrence, repeat_until,
+	repeat_day, created_by, created_at, updated_by`
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func computeInitialReminder(dueAt, now time.Time) (time.Time, int) {
-	for i := len(ReminderSchedule) - 1; i >= 0; i-- {
-		t := dueAt.Add(-ReminderSchedule[i])
-		if t.After(now) {
-			return t, i
+func scanDeadline(row rowScanner) (Deadline, error) {
+	var (
+		d               Deadline
+		dueAtStr        string
+		nextReminderStr string
+		remindersStr    string
+		ruleStr         string
+		untilStr        string
+		day             int
+		createdAtStr    string
+		err             error
+	)
+
+	if err := row.Scan(
+		&d.ID,
+		&d.GroupID,
+		&d.Title,
+		&dueAtStr,
+		&nextReminderStr,
+		&d.NextRemindIndex,
+		&remindersStr,
+		&ruleStr,
+		&untilStr,
+		&day,
+		&d.CreatedBy,
+		&createdAtStr,
+		&d.UpdatedBy,
+	); err != nil {
+		return Deadline{}, err
+	}
+
+	d.DueAt, err = time.Parse(time.RFC3339, dueAtStr)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	d.NextReminder, err = time.Parse(time.RFC3339, nextReminderStr)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	d.Reminders, err = ParseReminders(remindersStr)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	if ruleStr != "" {
+		d.Recurrence, err = ParseRecurrence(ruleStr)
+		if err != nil {
+			return Deadline{}, err
 		}
 	}
-	// No reminders left → next event is expiration
-	return dueAt, -1
+
+	d.Recurrence.Until, err = parseUntil(untilStr)
+	if err != nil {
+		return Deadline{}, err
+	}
+	d.Recurrence.Day = day
+
+	d.CreatedAt, err = parseTime(createdAtStr)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	return d, nil
 }
 
-func (dbs *DBStore) AddDeadline(ctx context.Context, title string, dueAt time.Time) (Deadline, error) {
+// AddDeadline creates a deadline. A nil reminders uses the store's default
+// schedule.
+func (dbs *DBStore) AddDeadline(ctx context.Context, group string, title string, dueAt time.Time, reminders []time.Duration, rec Recurrence, by string) (Deadline, error) {
+	if reminders == nil {
+		reminders = dbs.reminders
+	}
+
 	now := time.Now().UTC()
 	dueAt = dueAt.UTC()
-	nextReminder, nextIndex := computeInitialReminder(dueAt, now)
+	nextReminder, nextIndex := computeInitialReminder(dueAt, now, reminders)
+	if rec.Day == 0 {
+		rec = rec.anchored(dueAt, dbs.timezone)
+	}
 
 	const query = `
 		INSERT INTO deadlines (
+			group_id,
 			title,
 			due_at,
 			next_reminder,
-			next_remind_index
+			next_remind_index,
+			reminders,
+			recurrence,
+			repeat_until,
+			repeat_day,
+			created_by,
+			created_at
 		)
-		VALUES (?, ?, ?, ?);
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id;
 	`
 
-	res, err := dbs.db.ExecContext(
+	var id int
+	err := dbs.db.QueryRowContext(
 		ctx,
 		query,
+		group,
 		title,
 		dueAt.Format(time.RFC3339),
 		nextReminder.Format(time.RFC3339),
 		nextIndex,
-	)
-	if err != nil {
-		return Deadline{}, err
-	}
-
-	id, err := res.LastInsertId()
+		FormatReminders(reminders),
+		rec.Rule(),
+		formatUntil(rec.Until),
+		rec.Day,
+		by,
+		formatTime(now),
+	).Scan(&id)
 	if err != nil {
 		return Deadline{}, err
 	}
 
 	d := Deadline{
-		ID:              int(id),
+		ID:              id,
+		GroupID:         group,
 		Title:           title,
 		DueAt:           dueAt,
 		NextReminder:    nextReminder,
 		NextRemindIndex: nextIndex,
+		Reminders:       reminders,
+		Recurrence:      rec,
+		Attribution:     Attribution{CreatedBy: by, CreatedAt: now.Truncate(time.Second)},
 	}
 
+	dbs.notify()
+
 	return d, nil
 }
 
-func (dbs *DBStore) ListDeadlines(ctx context.Context) ([]Deadline, error) {
+func (dbs *DBStore) ListDeadlines(ctx context.Context, group string) ([]Deadline, error) {
 	const query = `
-		SELECT id, title, due_at, next_reminder, next_remind_index FROM deadlines
+		SELECT` + deadlineColumns + ` FROM deadlines
+		WHERE group_id = ?
 		ORDER BY due_at ASC;`
 
-	rows, err := dbs.db.QueryContext(ctx, query)
+	rows, err := dbs.db.QueryContext(ctx, query, group)
 	if err != nil {
 		return nil, err
 	}
@@ -83,28 +165,7 @@ func (dbs *DBStore) ListDeadlines(ctx context.Context) ([]Deadline, error) {
 	deadlines := []Deadline{}
 
 	for rows.Next() {
-		var (
-			d               Deadline
-			dueAtStr        string
-			nextReminderStr string
-		)
-
-		if err := rows.Scan(
-			&d.ID,
-			&d.Title,
-			&dueAtStr,
-			&nextReminderStr,
-			&d.NextRemindIndex,
-		); err != nil {
-			return nil, err
-		}
-
-		d.DueAt, err = time.Parse(time.RFC3339, dueAtStr)
-		if err != nil {
-			return nil, err
-		}
-
-		d.NextReminder, err = time.Parse(time.RFC3339, nextReminderStr)
+		d, err := scanDeadline(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -119,12 +180,82 @@ func (dbs *DBStore) ListDeadlines(ctx context.Context) ([]Deadline, error) {
 	return deadlines, nil
 }
 
-func (dbs *DBStore) DeleteDeadline(ctx context.Context, id int) error {
+func (dbs *DBStore) GetDeadline(ctx context.Context, group string, id int) (Deadline, error) {
+	const query = `
+		SELECT` + deadlineColumns + ` FROM deadlines
+		WHERE group_id = ? AND id = ?;`
+
+	d, err := scanDeadline(dbs.db.QueryRowContext(ctx, query, group, id))
+	if err == sql.ErrNoRows {
+		return Deadline{}, ErrDeadlineNotFound
+	}
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	return d, nil
+}
+
+// UpdateDeadline changes the title and due time of a deadline, keeping its ID.
+// If the due time changes, the reminder schedule restarts from the new one.
+func (dbs *DBStore) UpdateDeadline(ctx context.Context, group string, id int, title string, dueAt time.Time, by string) (Deadline, error) {
+	old, err := dbs.GetDeadline(ctx, group, id)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	dueAt = dueAt.UTC()
+	nextReminder, nextIndex := old.NextReminder, old.NextRemindIndex
+	rec := old.Recurrence
+	if !dueAt.Equal(old.DueAt) {
+		nextReminder, nextIndex = computeInitialReminder(dueAt, time.Now().UTC(), old.Reminders)
+		rec = rec.anchored(dueAt, dbs.timezone)
+	}
+
+	const query = `
+		UPDATE deadlines
+		SET
+			title = ?,
+			due_at = ?,
+			next_reminder = ?,
+			next_remind_index = ?,
+			repeat_day = ?,
+			updated_by = ?
+		WHERE group_id = ? AND id = ?
+		RETURNING` + deadlineColumns + `;`
+
+	row := dbs.db.QueryRowContext(
+		ctx,
+		query,
+		title,
+		dueAt.Format(time.RFC3339),
+		nextReminder.UTC().Format(time.RFC3339),
+		nextIndex,
+		rec.Day,
+		by,
+		group,
+		id,
+	)
+
+	d, err := scanDeadline(row)
+	if err == sql.ErrNoRows {
+		return Deadline{}, ErrDeadlineNotFound
+	}
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	dbs.notify()
+
+	return d, nil
+}
+
+func (dbs *DBStore) DeleteDeadline(ctx context.Context, group string, id int) error {
 	const query = `
 		DELETE FROM deadlines
-		WHERE id = ?;`
+		WHERE group_id = ? AND id = ?;`
 
-	res, err := dbs.db.ExecContext(ctx, query, id)
+	res, err := dbs.db.ExecContext(ctx, query, group, id)
 	if err != nil {
 		return err
 	}
@@ -135,19 +266,22 @@ func (dbs *DBStore) DeleteDeadline(ctx context.Context, id int) error {
 	}
 
 	if count == 0 {
-		return errors.New("deadline does not exist")
+		return ErrDeadlineNotFound
 	}
 
+	dbs.notify()
+
 	return nil
 }
 
-func (dbs *DBStore) ListDueDeadlines(ctx context.Context, now time.Time) ([]Deadline, error) {
-	const query = `
-		SELECT id, title, due_at, next_reminder, next_remind_index FROM deadlines
-		WHERE next_reminder <= ?
+func (dbs *DBStore) ListDueDeadlines(ctx context.Context, groups []string, now time.Time) ([]Deadline, error) {
+	cond, args := inGroups("group_id", groups)
+	query := `
+		SELECT` + deadlineColumns + ` FROM deadlines
+		WHERE next_reminder <= ? AND ` + cond + `
 		ORDER BY next_reminder ASC;`
 
-	rows, err := dbs.db.QueryContext(ctx, query, now.UTC().Format(time.RFC3339))
+	rows, err := dbs.db.QueryContext(ctx, query, append([]any{now.UTC().Format(time.RFC3339)}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -156,22 +290,7 @@ func (dbs *DBStore) ListDueDeadlines(ctx context.Context, now time.Time) ([]Dead
 	deadlines := []Deadline{}
 
 	for rows.Next() {
-		var (
-			d               Deadline
-			dueAtStr        string
-			nextReminderStr string
-		)
-
-		if err := rows.Scan(&d.ID, &d.Title, &dueAtStr, &nextReminderStr, &d.NextRemindIndex); err != nil {
-			return nil, err
-		}
-
-		d.DueAt, err = time.Parse(time.RFC3339, dueAtStr)
-		if err != nil {
-			return nil, err
-		}
-
-		d.NextReminder, err = time.Parse(time.RFC3339, nextReminderStr)
+		d, err := scanDeadline(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -186,27 +305,67 @@ func (dbs *DBStore) ListDueDeadlines(ctx context.Context, now time.Time) ([]Dead
 	return deadlines, nil
 }
 
-func (dbs *DBStore) UpdateNextReminder(ctx context.Context, id int, nextTime time.Time, nextIndex int) error {
+// SetReminders replaces the reminder schedule of a deadline and restarts it
+// from the current time.
+func (dbs *DBStore) SetReminders(ctx context.Context, group string, id int, reminders []time.Duration, by string) (Deadline, error) {
+	old, err := dbs.GetDeadline(ctx, group, id)
+	if err != nil {
+		return Deadline{}, err
+	}
+
+	nextReminder, nextIndex := computeInitialReminder(old.DueAt, time.Now().UTC(), reminders)
+
 	const query = `
 		UPDATE deadlines
 		SET
+			reminders = ?,
 			next_reminder = ?,
-			next_remind_index = ?
-		WHERE id = ?; `
+			next_remind_index = ?,
+			updated_by = ?
+		WHERE group_id = ? AND id = ?
+		RETURNING` + deadlineColumns + `;`
+
+	row := dbs.db.QueryRowContext(
+		ctx,
+		query,
+		FormatReminders(reminders),
+		nextReminder.UTC().Format(time.RFC3339),
+		nextIndex,
+		by,
+		group,
+		id,
+	)
 
-	res, err := dbs.db.ExecContext(ctx, query, nextTime.UTC().Format(time.RFC3339), nextIndex, id)
+	d, err := scanDeadline(row)
+	if err == sql.ErrNoRows {
+		return Deadline{}, ErrDeadlineNotFound
+	}
 	if err != nil {
-		return err
+		return Deadline{}, err
 	}
 
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
+	dbs.notify()
+
+	return d, nil
+}
+
+func (dbs *DBStore) NextReminderAt(ctx context.Context, groups []string) (time.Time, bool, error) {
+	cond, args := inGroups("group_id", groups)
+	query := `SELECT MIN(next_reminder) FROM deadlines WHERE ` + cond + `;`
+
+	var next sql.NullString
+	if err := dbs.db.QueryRowContext(ctx, query, args...).Scan(&next); err != nil {
+		return time.Time{}, false, err
 	}
 
-	if rows == 0 {
-		return errors.New("deadline not found")
+	if !next.Valid {
+		return time.Time{}, false, nil
 	}
 
-	return nil
+	t, err := time.Parse(time.RFC3339, next.String)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return t, true, nil
 }
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Drivers accepted by Open and NewDBStore.
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// Open connects to a database without migrating it. For SQLite dsn is the
+// path of the database file.
+func Open(driver, dsn string) (*sql.DB, error) {
+	switch driver {
+	case SQLite:
+		// Pragmas in the DSN apply to every connection in the pool, not
+		// just the first one. Transactions all write, so they take the
+		// write lock as they begin rather than failing to upgrade to it
+		// after another connection wrote.
+		return sql.Open("sqlite", "file:"+dsn+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	case Postgres:
+		return sql.Open("pgx", dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
+
+// querier runs the queries of a DBStore, against the database or within a
+// transaction. Queries are written with ? placeholders and rewritten for the
+// driver before they run.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (transaction, error)
+}
+
+type transaction interface {
+	querier
+	Commit() error
+	Rollback() error
+}
+
+// database is a *sql.DB querier.
+type database struct {
+	*sql.DB
+	driver string
+}
+
+func (db *database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, rebind(db.driver, query), args...)
+}
+
+func (db *database) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, rebind(db.driver, query), args...)
+}
+
+func (db *database) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.DB.QueryRowContext(ctx, rebind(db.driver, query), args...)
+}
+
+func (db *database) BeginTx(ctx context.Context, opts *sql.TxOptions) (transaction, error) {
+	t, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, driver: db.driver}, nil
+}
+
+// tx is a *sql.Tx querier.
+type tx struct {
+	*sql.Tx
+	driver string
+}
+
+// BeginTx continues t, so that a DBStore used within a transaction can still
+// call methods that make their own.
+func (t *tx) BeginTx(ctx context.Context, opts *sql.TxOptions) (transaction, error) {
+	return nested{t}, nil
+}
+
+// nested is a transaction continued by BeginTx. Committing or rolling it back
+// is left to whoever began it.
+type nested struct {
+	*tx
+}
+
+func (nested) Commit() error   { return nil }
+func (nested) Rollback() error { return nil }
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, rebind(t.driver, query), args...)
+}
+
+func (t *tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, rebind(t.driver, query), args...)
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, rebind(t.driver, query), args...)
+}
+
+// rebind turns the ? placeholders of query into $1, $2, ... for Postgres.
+// Question marks inside string literals are left alone.
+func rebind(driver, query string) string {
+	if driver != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// isSerializationFailure reports whether err is Postgres failing to serialize
+// a transaction with a concurrent one, which may succeed if run again.
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+// inGroups returns a condition limiting column to groups, and its arguments.
+// No groups means no limit.
+func inGroups(column string, groups []string) (string, []any) {
+	if len(groups) == 0 {
+		return "1 = 1", nil
+	}
+
+	args := make([]any, len(groups))
+	for i, g := range groups {
+		args[i] = g
+	}
+
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(groups)), ", ") + ")", args
+}
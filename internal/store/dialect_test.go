@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		driver, in, want string
+	}{
+		{SQLite, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{Postgres, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{Postgres, "UPDATE t SET s = 'why?' WHERE id = ?", "UPDATE t SET s = 'why?' WHERE id = $1"},
+		{Postgres, "SELECT 1", "SELECT 1"},
+	}
+
+	for _, tt := range tests {
+		if got := rebind(tt.driver, tt.in); got != tt.want {
+			t.Errorf("rebind(%s, %q) = %q, want %q", tt.driver, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsSerializationFailure(t *testing.T) {
+	conflict := &pgconn.PgError{Code: "40001"}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{conflict, true},
+		{fmt.Errorf("commit: %w", conflict), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{fmt.Errorf("database is locked"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isSerializationFailure(tt.err); got != tt.want {
+			t.Errorf("isSerializationFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,915 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore keeps everything in memory, for tests and throwaway REPL sessions.
+// It behaves like DBStore, down to keeping times to the second, and is safe
+// for concurrent use.
+type MemStore struct {
+	// mu is a sync.Mutex, except in the MemStore a WithAudit change is given,
+	// which runs with it already held.
+	mu        sync.Locker
+	timezone  *time.Location
+	reminders []time.Duration
+	changes   chan struct{}
+	*memData
+}
+
+type memData struct {
+	deadlines map[int]Deadline
+	baskets   []*memBasket
+	outbox    []*memMessage
+	roles     map[memRoleKey]Role
+	audit     []memAuditEntry
+
+	lastDeadlineID int
+	lastBasketID   int
+	lastPinID      int
+	lastMessageID  int
+	lastAuditID    int
+}
+
+type memBasket struct {
+	ID          int
+	Group       string
+	Name        string
+	Description string
+	Pins        []Pin
+	DeletedAt   time.Time // zero unless trashed
+}
+
+type memRoleKey struct {
+	Group, User string
+}
+
+type memAuditEntry struct {
+	AuditEntry
+	Group string
+}
+
+type memMessage struct {
+	OutboxMessage
+	Status      string // pending, delivered or dropped
+	NextAttempt time.Time
+}
+
+// NewMemStore returns an empty MemStore. New deadlines get the reminder schedule
+// reminders unless given their own; nil means DefaultReminderSchedule.
+func NewMemStore(timezone *time.Location, reminders []time.Duration) *MemStore {
+	if reminders == nil {
+		reminders = DefaultReminderSchedule
+	}
+
+	return &MemStore{
+		mu:        &sync.Mutex{},
+		timezone:  timezone,
+		reminders: reminders,
+		changes:   make(chan struct{}, 1),
+		memData: &memData{
+			deadlines: map[int]Deadline{},
+			roles:     map[memRoleKey]Role{},
+		},
+	}
+}
+
+// clone returns a copy of d sharing nothing it could change.
+func (d *memData) clone() *memData {
+	c := *d
+	c.deadlines = maps.Clone(d.deadlines)
+	c.roles = maps.Clone(d.roles)
+	c.audit = slices.Clone(d.audit)
+
+	c.baskets = make([]*memBasket, len(d.baskets))
+	for i, b := range d.baskets {
+		copied := *b
+		copied.Pins = slices.Clone(b.Pins)
+		c.baskets[i] = &copied
+	}
+
+	c.outbox = make([]*memMessage, len(d.outbox))
+	for i, m := range d.outbox {
+		copied := *m
+		c.outbox[i] = &copied
+	}
+
+	return &c
+}
+
+// seconds drops what DBStore loses by storing times as RFC3339.
+func seconds(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// copyDeadline returns d with its own Reminders, so callers can't change
+// what is stored.
+func copyDeadline(d Deadline) Deadline {
+	d.Reminders = slices.Clone(d.Reminders)
+	if d.Reminders == nil {
+		d.Reminders = []time.Duration{}
+	}
+	return d
+}
+
+func (ms *MemStore) AddDeadline(ctx context.Context, group string, title string, dueAt time.Time, reminders []time.Duration, rec Recurrence, by string) (Deadline, error) {
+	if reminders == nil {
+		reminders = ms.reminders
+	}
+
+	dueAt = seconds(dueAt)
+	nextReminder, nextIndex := computeInitialReminder(dueAt, time.Now().UTC(), reminders)
+	rec.Until = seconds(rec.Until)
+	if rec.Day == 0 {
+		rec = rec.anchored(dueAt, ms.timezone)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.lastDeadlineID++
+
+	d := Deadline{
+		ID:              ms.lastDeadlineID,
+		GroupID:         group,
+		Title:           title,
+		DueAt:           dueAt,
+		NextReminder:    seconds(nextReminder),
+		NextRemindIndex: nextIndex,
+		Reminders:       slices.Clone(reminders),
+		Recurrence:      rec,
+		Attribution:     Attribution{CreatedBy: by, CreatedAt: seconds(time.Now())},
+	}
+	ms.deadlines[d.ID] = d
+
+	ms.notify()
+
+	return copyDeadline(d), nil
+}
+
+func (ms *MemStore) ListDeadlines(ctx context.Context, group string) ([]Deadline, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	deadlines := []Deadline{}
+	for _, d := range ms.deadlines {
+		if d.GroupID == group {
+			deadlines = append(deadlines, copyDeadline(d))
+		}
+	}
+
+	slices.SortFunc(deadlines, func(a, b Deadline) int {
+		return cmp.Or(a.DueAt.Compare(b.DueAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return deadlines, nil
+}
+
+func (ms *MemStore) GetDeadline(ctx context.Context, group string, id int) (Deadline, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	d, ok := ms.deadlines[id]
+	if !ok || d.GroupID != group {
+		return Deadline{}, ErrDeadlineNotFound
+	}
+
+	return copyDeadline(d), nil
+}
+
+func (ms *MemStore) UpdateDeadline(ctx context.Context, group string, id int, title string, dueAt time.Time, by string) (Deadline, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	d, ok := ms.deadlines[id]
+	if !ok || d.GroupID != group {
+		return Deadline{}, ErrDeadlineNotFound
+	}
+
+	dueAt = seconds(dueAt)
+	if !dueAt.Equal(d.DueAt) {
+		next, index := computeInitialReminder(dueAt, time.Now().UTC(), d.Reminders)
+		d.NextReminder, d.NextRemindIndex = seconds(next), index
+		d.Recurrence = d.Recurrence.anchored(dueAt, ms.timezone)
+	}
+	d.Title = title
+	d.DueAt = dueAt
+	d.UpdatedBy = by
+	ms.deadlines[id] = d
+
+	ms.notify()
+
+	return copyDeadline(d), nil
+}
+
+func (ms *MemStore) SetReminders(ctx context.Context, group string, id int, reminders []time.Duration, by string) (Deadline, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	d, ok := ms.deadlines[id]
+	if !ok || d.GroupID != group {
+		return Deadline{}, ErrDeadlineNotFound
+	}
+
+	next, index := computeInitialReminder(d.DueAt, time.Now().UTC(), reminders)
+	d.NextReminder, d.NextRemindIndex = seconds(next), index
+	d.Reminders = slices.Clone(reminders)
+	d.UpdatedBy = by
+	ms.deadlines[id] = d
+
+	ms.notify()
+
+	return copyDeadline(d), nil
+}
+
+func (ms *MemStore) DeleteDeadline(ctx context.Context, group string, id int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	d, ok := ms.deadlines[id]
+	if !ok || d.GroupID != group {
+		return ErrDeadlineNotFound
+	}
+
+	delete(ms.deadlines, id)
+
+	ms.notify()
+
+	return nil
+}
+
+func (ms *MemStore) ListDueDeadlines(ctx context.Context, groups []string, now time.Time) ([]Deadline, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now = seconds(now)
+
+	deadlines := []Deadline{}
+	for _, d := range ms.deadlines {
+		if !d.NextReminder.After(now) && inList(groups, d.GroupID) {
+			deadlines = append(deadlines, copyDeadline(d))
+		}
+	}
+
+	slices.SortFunc(deadlines, func(a, b Deadline) int {
+		return cmp.Or(a.NextReminder.Compare(b.NextReminder), cmp.Compare(a.ID, b.ID))
+	})
+
+	return deadlines, nil
+}
+
+func (ms *MemStore) NextReminderAt(ctx context.Context, groups []string) (time.Time, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, d := range ms.deadlines {
+		if inList(groups, d.GroupID) && (!found || d.NextReminder.Before(next)) {
+			next, found = d.NextReminder, true
+		}
+	}
+
+	return next, found, nil
+}
+
+// inList reports whether list contains s. An empty list contains everything.
+func inList(list []string, s string) bool {
+	return len(list) == 0 || slices.Contains(list, s)
+}
+
+func (ms *MemStore) Changes() <-chan struct{} {
+	return ms.changes
+}
+
+func (ms *MemStore) notify() {
+	select {
+	case ms.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (ms *MemStore) ApplyDeadlineChanges(ctx context.Context, changes []DeadlineChange, messages []OutboxMessage) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Work on a copy so a stale change leaves everything as it was.
+	deadlines := maps.Clone(ms.deadlines)
+
+	for _, c := range changes {
+		d, ok := deadlines[c.From.ID]
+		if !ok || !d.NextReminder.Equal(seconds(c.From.NextReminder)) || d.NextRemindIndex != c.From.NextRemindIndex {
+			return ErrStaleDeadline
+		}
+
+		if c.Delete {
+			delete(deadlines, d.ID)
+			continue
+		}
+
+		d.DueAt = seconds(c.From.DueAt)
+		if !c.DueAt.IsZero() {
+			d.DueAt = seconds(c.DueAt)
+		}
+		d.NextReminder = seconds(c.NextReminder)
+		d.NextRemindIndex = c.NextRemindIndex
+		deadlines[d.ID] = d
+	}
+
+	now := seconds(time.Now())
+	var queued []*memMessage
+
+	for _, m := range messages {
+		key, err := newOutboxKey()
+		if err != nil {
+			return err
+		}
+
+		ms.lastMessageID++
+		queued = append(queued, &memMessage{
+			OutboxMessage: OutboxMessage{
+				ID:        ms.lastMessageID,
+				Key:       key,
+				Chat:      m.Chat,
+				Text:      m.Text,
+				CreatedAt: now,
+			},
+			Status:      "pending",
+			NextAttempt: now,
+		})
+	}
+
+	ms.deadlines = deadlines
+	ms.outbox = append(ms.outbox, queued...)
+
+	return nil
+}
+
+func (ms *MemStore) PendingMessages(ctx context.Context, chats []string, now time.Time) ([]OutboxMessage, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now = seconds(now)
+
+	messages := []OutboxMessage{}
+	for _, m := range ms.outbox {
+		if m.Status == "pending" && !m.NextAttempt.After(now) && inList(chats, m.Chat) {
+			messages = append(messages, m.OutboxMessage)
+		}
+	}
+
+	return messages, nil
+}
+
+func (ms *MemStore) NextDeliveryAt(ctx context.Context, chats []string) (time.Time, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var (
+		next  time.Time
+		found bool
+	)
+	for _, m := range ms.outbox {
+		if m.Status == "pending" && inList(chats, m.Chat) && (!found || m.NextAttempt.Before(next)) {
+			next, found = m.NextAttempt, true
+		}
+	}
+
+	return next, found, nil
+}
+
+func (ms *MemStore) MarkDelivered(ctx context.Context, id int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m := ms.message(id)
+	if m == nil {
+		return ErrMessageNotFound
+	}
+
+	m.Status = "delivered"
+
+	return nil
+}
+
+func (ms *MemStore) MarkFailed(ctx context.Context, id int, reason string, retryAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	m := ms.message(id)
+	if m == nil {
+		return ErrMessageNotFound
+	}
+
+	m.Attempts++
+	if retryAt.IsZero() {
+		m.Status = "dropped"
+	} else {
+		m.NextAttempt = seconds(retryAt)
+	}
+
+	return nil
+}
+
+func (ms *MemStore) PruneOutbox(ctx context.Context, chats []string, cutoff time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	cutoff = seconds(cutoff)
+
+	n := len(ms.outbox)
+	ms.outbox = slices.DeleteFunc(ms.outbox, func(m *memMessage) bool {
+		return m.Status != "pending" && m.CreatedAt.Before(cutoff) && inList(chats, m.Chat)
+	})
+
+	return n - len(ms.outbox), nil
+}
+
+func (ms *MemStore) message(id int) *memMessage {
+	for _, m := range ms.outbox {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (ms *MemStore) AddBasket(ctx context.Context, group string, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if err := ms.nameTaken(group, name, nil); err != nil {
+		return err
+	}
+
+	ms.lastBasketID++
+	ms.baskets = append(ms.baskets, &memBasket{ID: ms.lastBasketID, Group: group, Name: name})
+
+	return nil
+}
+
+func (ms *MemStore) ListBaskets(ctx context.Context, group string) ([]Basket, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	baskets := []Basket{}
+	for _, b := range ms.baskets {
+		if b.Group == group && b.DeletedAt.IsZero() {
+			baskets = append(baskets, Basket{Name: b.Name, Description: b.Description, Pins: len(b.Pins)})
+		}
+	}
+	slices.SortFunc(baskets, func(a, b Basket) int { return strings.Compare(a.Name, b.Name) })
+
+	return baskets, nil
+}
+
+func (ms *MemStore) DeleteBasket(ctx context.Context, group string, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b := ms.basket(group, strings.ToLower(name))
+	if b == nil {
+		return ErrBasketNotFound
+	}
+
+	b.DeletedAt = seconds(time.Now())
+
+	return nil
+}
+
+func (ms *MemStore) ListTrash(ctx context.Context, group string) ([]Basket, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	baskets := []Basket{}
+	for _, b := range ms.baskets {
+		if b.Group == group && !b.DeletedAt.IsZero() {
+			baskets = append(baskets, Basket{Name: b.Name, Description: b.Description, Pins: len(b.Pins), DeletedAt: b.DeletedAt})
+		}
+	}
+	slices.SortFunc(baskets, func(a, b Basket) int {
+		return cmp.Or(b.DeletedAt.Compare(a.DeletedAt), strings.Compare(a.Name, b.Name))
+	})
+
+	return baskets, nil
+}
+
+func (ms *MemStore) RestoreBasket(ctx context.Context, group string, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	name = strings.ToLower(name)
+	for _, b := range ms.baskets {
+		if b.Group == group && b.Name == name && !b.DeletedAt.IsZero() {
+			b.DeletedAt = time.Time{}
+			return nil
+		}
+	}
+
+	return ErrNotInTrash
+}
+
+func (ms *MemStore) PurgeTrash(ctx context.Context, groups []string, cutoff time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	before := len(ms.baskets)
+
+	// The basket's pins go with it, as with ON DELETE CASCADE.
+	ms.baskets = slices.DeleteFunc(ms.baskets, func(b *memBasket) bool {
+		return !b.DeletedAt.IsZero() && b.DeletedAt.Before(seconds(cutoff)) && inList(groups, b.Group)
+	})
+
+	return before - len(ms.baskets), nil
+}
+
+func (ms *MemStore) RenameBasket(ctx context.Context, group string, name string, newName string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b := ms.basket(group, strings.ToLower(name))
+	if b == nil {
+		return ErrBasketNotFound
+	}
+
+	newName = strings.ToLower(newName)
+	if err := ms.nameTaken(group, newName, b); err != nil {
+		return err
+	}
+
+	b.Name = newName
+
+	return nil
+}
+
+func (ms *MemStore) SetBasketDescription(ctx context.Context, group string, name string, description string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b := ms.basket(group, strings.ToLower(name))
+	if b == nil {
+		return ErrBasketNotFound
+	}
+
+	b.Description = description
+
+	return nil
+}
+
+// basket returns the basket called name in group, or nil if there is none
+// or it is in the trash. name must be lower case.
+func (ms *MemStore) basket(group, name string) *memBasket {
+	for _, b := range ms.baskets {
+		if b.Group == group && b.Name == name && b.DeletedAt.IsZero() {
+			return b
+		}
+	}
+	return nil
+}
+
+// nameTaken reports whether a basket of group other than self, trashed or
+// not, is called name. name must be lower case.
+func (ms *MemStore) nameTaken(group, name string, self *memBasket) error {
+	for _, b := range ms.baskets {
+		if b.Group != group || b.Name != name || b == self {
+			continue
+		}
+		if !b.DeletedAt.IsZero() {
+			return ErrBasketInTrash
+		}
+		return ErrBasketExists
+	}
+	return nil
+}
+
+func (ms *MemStore) AddPin(ctx context.Context, group string, basketName string, pin Pin) (Pin, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b := ms.basket(group, strings.ToLower(basketName))
+	if b == nil {
+		return Pin{}, ErrBasketNotFound
+	}
+
+	ms.lastPinID++
+	pin.ID = ms.lastPinID
+	if !pin.Source.SentAt.IsZero() {
+		pin.Source.SentAt = seconds(pin.Source.SentAt)
+	}
+	pin.Basket = b.Name
+	pin.CreatedAt = seconds(time.Now())
+	pin.UpdatedBy = ""
+	b.Pins = append(b.Pins, pin)
+
+	return pin, nil
+}
+
+func (ms *MemStore) ListPins(ctx context.Context, group string, basketName string) ([]Pin, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b := ms.basket(group, strings.ToLower(basketName))
+	if b == nil {
+		return nil, ErrBasketNotFound
+	}
+
+	pins := []Pin{}
+	for _, p := range b.Pins {
+		p.Basket = b.Name
+		pins = append(pins, p)
+	}
+	return pins, nil
+}
+
+func (ms *MemStore) GetPin(ctx context.Context, group string, id int) (Pin, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, i := ms.pin(group, id)
+	if b == nil {
+		return Pin{}, ErrPinNotFound
+	}
+
+	p := b.Pins[i]
+	p.Basket = b.Name
+	return p, nil
+}
+
+func (ms *MemStore) DeletePin(ctx context.Context, group string, id int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, i := ms.pin(group, id)
+	if b == nil {
+		return ErrPinNotFound
+	}
+
+	b.Pins = slices.Delete(b.Pins, i, i+1)
+
+	return nil
+}
+
+func (ms *MemStore) EditPin(ctx context.Context, group string, id int, content string, by string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, i := ms.pin(group, id)
+	if b == nil {
+		return ErrPinNotFound
+	}
+
+	b.Pins[i].Content = content
+	b.Pins[i].UpdatedBy = by
+
+	return nil
+}
+
+func (ms *MemStore) MovePin(ctx context.Context, group string, id int, basketName string, by string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	from, i := ms.pin(group, id)
+	if from == nil {
+		return ErrPinNotFound
+	}
+
+	to := ms.basket(group, strings.ToLower(basketName))
+	if to == nil {
+		return ErrBasketNotFound
+	}
+
+	p := from.Pins[i]
+	p.UpdatedBy = by
+	from.Pins = slices.Delete(from.Pins, i, i+1)
+	to.Pins = append(to.Pins, p)
+
+	return nil
+}
+
+func (ms *MemStore) SetPinPosition(ctx context.Context, group string, id int, position int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, i := ms.pin(group, id)
+	if b == nil {
+		return ErrPinNotFound
+	}
+
+	p := b.Pins[i]
+	b.Pins = slices.Delete(b.Pins, i, i+1)
+	b.Pins = slices.Insert(b.Pins, min(max(position, 1), len(b.Pins)+1)-1, p)
+
+	return nil
+}
+
+// pin returns the basket holding the pin id of group and its index there, or
+// nil.
+func (ms *MemStore) pin(group string, id int) (*memBasket, int) {
+	for _, b := range ms.baskets {
+		if b.Group != group || !b.DeletedAt.IsZero() {
+			continue
+		}
+
+		if i := slices.IndexFunc(b.Pins, func(p Pin) bool { return p.ID == id }); i >= 0 {
+			return b, i
+		}
+	}
+	return nil, -1
+}
+
+func (ms *MemStore) MediaInUse(ctx context.Context) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sums := []string{}
+	for _, b := range ms.baskets {
+		for _, p := range b.Pins {
+			if p.Media.SHA256 != "" && !slices.Contains(sums, p.Media.SHA256) {
+				sums = append(sums, p.Media.SHA256)
+			}
+		}
+	}
+
+	return sums, nil
+}
+
+// SearchPins ranks pins by how many of their words match the query.
+func (ms *MemStore) SearchPins(ctx context.Context, group string, basket string, query string, limit int) ([]PinMatch, error) {
+	terms, err := searchTerms(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if basket != "" {
+		basket = strings.ToLower(basket)
+		if ms.basket(group, basket) == nil {
+			return nil, ErrBasketNotFound
+		}
+	}
+
+	type scored struct {
+		PinMatch
+		score int
+	}
+	var hits []scored
+
+	for _, b := range ms.baskets {
+		if b.Group != group || !b.DeletedAt.IsZero() || (basket != "" && b.Name != basket) {
+			continue
+		}
+
+		for _, p := range b.Pins {
+			words := strings.FieldsFunc(p.Content, func(r rune) bool { return !isWordRune(r) })
+
+			score := 0
+			for _, t := range terms {
+				n := 0
+				for _, w := range words {
+					if matchesTerm(w, []string{t}) {
+						n++
+					}
+				}
+				if n == 0 {
+					score = 0
+					break
+				}
+				score += n
+			}
+
+			if score > 0 {
+				p.Basket = b.Name
+				hits = append(hits, scored{PinMatch{Pin: p, Snippet: highlight(p.Content, terms)}, score})
+			}
+		}
+	}
+
+	slices.SortFunc(hits, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(a.ID, b.ID))
+	})
+
+	matches := []PinMatch{}
+	for _, h := range hits[:min(limit, len(hits))] {
+		matches = append(matches, h.PinMatch)
+	}
+
+	return matches, nil
+}
+
+func (ms *MemStore) GetRole(ctx context.Context, group string, user string) (Role, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	role, ok := ms.roles[memRoleKey{group, user}]
+	return role, ok, nil
+}
+
+func (ms *MemStore) SetRole(ctx context.Context, group string, user string, role Role) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.roles[memRoleKey{group, user}] = role
+	return nil
+}
+
+func (ms *MemStore) ClearRole(ctx context.Context, group string, user string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := memRoleKey{group, user}
+	if _, ok := ms.roles[key]; !ok {
+		return ErrRoleNotSet
+	}
+
+	delete(ms.roles, key)
+	return nil
+}
+
+func (ms *MemStore) ListRoles(ctx context.Context, group string) ([]RoleAssignment, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	roles := []RoleAssignment{}
+	for key, role := range ms.roles {
+		if key.Group == group {
+			roles = append(roles, RoleAssignment{User: key.User, Role: role})
+		}
+	}
+	slices.SortFunc(roles, func(a, b RoleAssignment) int { return strings.Compare(a.User, b.User) })
+
+	return roles, nil
+}
+
+func (ms *MemStore) AddAuditEntry(ctx context.Context, group string, entry AuditEntry) (AuditEntry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.lastAuditID++
+	entry.ID = ms.lastAuditID
+	entry.At = seconds(time.Now())
+	ms.audit = append(ms.audit, memAuditEntry{AuditEntry: entry, Group: group})
+
+	return entry, nil
+}
+
+func (ms *MemStore) WithAudit(ctx context.Context, group string, change func(s Store) (AuditEntry, error)) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	saved := ms.memData.clone()
+	inTx := &MemStore{
+		mu:        noLock{},
+		timezone:  ms.timezone,
+		reminders: ms.reminders,
+		changes:   ms.changes,
+		memData:   ms.memData,
+	}
+
+	entry, err := change(inTx)
+	if err == nil && entry.changed() {
+		_, err = inTx.AddAuditEntry(ctx, group, entry)
+	}
+	if err != nil {
+		*ms.memData = *saved
+		return err
+	}
+
+	return nil
+}
+
+// noLock is the sync.Locker of a MemStore whose lock is already held.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+func (ms *MemStore) ListAuditEntries(ctx context.Context, group string, limit int) ([]AuditEntry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for i := len(ms.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if ms.audit[i].Group == group {
+			entries = append(entries, ms.audit[i].AuditEntry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (ms *MemStore) Timezone() *time.Location {
+	return ms.timezone
+}
+
+var _ Store = (*MemStore)(nil)
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one step of the database schema, stored in the binary as
+// migrations/NNNN_name.sql. Versions start at 1 and have no gaps. A step that
+// Postgres needs written differently has a NNNN_name.postgres.sql next to it.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationStatus is a migration and whether it has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const CREATE_SCHEMA_VERSION_TABLE = `
+CREATE TABLE IF NOT EXISTS schema_version(
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TEXT NOT NULL -- RFC3339 UTC
+);`
+
+// migrationLock is the Postgres advisory lock held while migrating, so bots
+// sharing a database don't migrate it at the same time.
+const migrationLock = 0x72656d79 // "remy"
+
+// Migrations returns every migration embedded in the binary for driver, in
+// order.
+func Migrations(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		migrations []Migration
+		overrides  = map[int]Migration{}
+	)
+
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		base, dialect, hasDialect := strings.Cut(base, ".")
+
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.sql", e.Name())
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", e.Name(), err)
+		}
+
+		b, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := Migration{Version: version, Name: name, SQL: string(b)}
+
+		switch {
+		case !hasDialect:
+			migrations = append(migrations, m)
+		case dialect == Postgres:
+			overrides[version] = m
+		default:
+			return nil, fmt.Errorf("migration %s: unknown driver %q", e.Name(), dialect)
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d_%s: expected version %d", m.Version, m.Name, i+1)
+		}
+
+		o, ok := overrides[m.Version]
+		if !ok {
+			continue
+		}
+		if o.Name != m.Name {
+			return nil, fmt.Errorf("migration %04d_%s.%s.sql: name does not match %04d_%s.sql", o.Version, o.Name, Postgres, m.Version, m.Name)
+		}
+		if driver == Postgres {
+			migrations[i] = o
+		}
+		delete(overrides, m.Version)
+	}
+
+	for _, o := range overrides {
+		return nil, fmt.Errorf("migration %04d_%s.%s.sql: no matching %04d_%s.sql", o.Version, o.Name, Postgres, o.Version, o.Name)
+	}
+
+	return migrations, nil
+}
+
+// Migrate brings the schema up to date, applying each pending migration in
+// its own transaction.
+func Migrate(ctx context.Context, db *sql.DB, driver string) error {
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return err
+	}
+
+	// Session settings and locks below belong to one connection, so pin it
+	// for the whole run.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if driver == Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationLock); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", migrationLock)
+	}
+
+	if _, err := conn.ExecContext(ctx, CREATE_SCHEMA_VERSION_TABLE); err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary (%d)", current, len(migrations))
+	}
+
+	// SQLite can only change some constraints by rebuilding tables, which
+	// needs foreign keys off.
+	if driver == SQLite {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF;"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON;")
+	}
+
+	for _, m := range migrations[current:] {
+		if err := applyMigration(ctx, conn, driver, m); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		log.Info().
+			Int("version", m.Version).
+			Str("name", m.Name).
+			Msg("applied database migration")
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, driver string, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+
+	// Rebuilding tables with foreign keys off must not leave dangling rows.
+	if driver == SQLite {
+		rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check;")
+		if err != nil {
+			return err
+		}
+		violation := rows.Next()
+		rows.Close()
+		if violation {
+			return fmt.Errorf("foreign key violation")
+		}
+	}
+
+	const query = `
+		INSERT INTO schema_version (version, name, applied_at)
+		VALUES (?, ?, ?);`
+
+	if _, err := tx.ExecContext(ctx, rebind(driver, query), m.Version, m.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_version;").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Status reports which of the embedded migrations have been applied to db,
+// without changing anything.
+func Status(ctx context.Context, db *sql.DB, driver string) ([]MigrationStatus, error) {
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+
+	tableQuery := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version';`
+	if driver == Postgres {
+		tableQuery = `
+			SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = 'schema_version';`
+	}
+
+	var exists int
+	if err := db.QueryRowContext(ctx, tableQuery).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if exists > 0 {
+		rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_version;")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				version      int
+				appliedAtStr string
+			)
+			if err := rows.Scan(&version, &appliedAtStr); err != nil {
+				return nil, err
+			}
+
+			applied[version], err = time.Parse(time.RFC3339, appliedAtStr)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		at, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: at}
+	}
+
+	return statuses, nil
+}
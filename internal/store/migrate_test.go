@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// legacySchema is the schema databases had before migrations, with data.
+const legacySchema = `
+CREATE TABLE deadlines(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	due_at TEXT NOT NULL,
+	next_reminder TEXT NOT NULL,
+	next_remind_index INTEGER NOT NULL,
+	CHECK (
+		(next_remind_index >= 0)
+		OR
+		(next_remind_index = -1 AND next_reminder = due_at)
+	)
+);
+CREATE INDEX idx_deadlines_next_reminder ON deadlines(next_reminder);
+CREATE TABLE baskets(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE NOT NULL
+);
+CREATE TABLE pins(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	content TEXT NOT NULL,
+	basket_id INTEGER NOT NULL,
+	FOREIGN KEY(basket_id) REFERENCES baskets(id) ON DELETE CASCADE
+);
+INSERT INTO deadlines VALUES (1, 'essay', '2030-01-02T00:00:00Z', '2030-01-01T00:00:00Z', 0);
+INSERT INTO baskets VALUES (1, 'links'), (2, 'notes');
+INSERT INTO pins VALUES (1, 'https://example.com', 1), (2, 'buy milk', 2);
+`
+
+func TestMigrationsAreSequential(t *testing.T) {
+	for _, driver := range []string{SQLite, Postgres} {
+		migrations, err := Migrations(driver)
+		if err != nil {
+			t.Fatalf("%s: %v", driver, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: no migrations embedded", driver)
+		}
+	}
+}
+
+func TestMigrateUpgradesLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "remy.db")
+
+	db, err := Open(SQLite, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := NewDBStore(SQLite, path, time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewDBStore: %v", err)
+	}
+
+	sqlDB := s.db.(*database).DB
+
+	statuses, err := Status(ctx, sqlDB, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if !st.Applied {
+			t.Errorf("migration %04d_%s not applied", st.Version, st.Name)
+		}
+	}
+
+	if n, err := s.ClaimUnassigned(ctx, "g1"); err != nil || n != 3 {
+		t.Fatalf("ClaimUnassigned = %d, %v; want 3", n, err)
+	}
+
+	deadlines, err := s.ListDeadlines(ctx, "g1")
+	if err != nil || len(deadlines) != 1 || deadlines[0].Title != "essay" {
+		t.Fatalf("ListDeadlines = %v, %v", deadlines, err)
+	}
+	if len(deadlines[0].Reminders) == 0 {
+		t.Error("legacy deadline has no reminder schedule")
+	}
+
+	pins, err := s.ListPins(ctx, "g1", "links")
+	if err != nil || len(pins) != 1 || pins[0].Content != "https://example.com" {
+		t.Fatalf("ListPins = %v, %v", pins, err)
+	}
+
+	// Purging a rebuilt basket must still cascade to its pins.
+	if err := s.DeleteBasket(ctx, "g1", "notes"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.PurgeTrash(ctx, nil, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("PurgeTrash = %d, %v; want 1", n, err)
+	}
+	var orphans int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM pins WHERE basket_id = 2;").Scan(&orphans); err != nil {
+		t.Fatal(err)
+	}
+	if orphans != 0 {
+		t.Errorf("%d pins left behind by deleted basket", orphans)
+	}
+
+	// Running again is a no-op.
+	if err := Migrate(ctx, sqlDB, SQLite); err != nil {
+		t.Errorf("second Migrate: %v", err)
+	}
+}
+
+func TestClaimUnassigned(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewDBStore(SQLite, filepath.Join(t.TempDir(), "remy.db"), time.UTC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AddDeadline(ctx, "", "old", time.Now().Add(48*time.Hour), nil, Recurrence{}, "")
+	s.AddBasket(ctx, "", "notes")
+	s.AddBasket(ctx, "", "links")
+	s.AddBasket(ctx, "g", "links")
+
+	if n, err := s.CountUnassigned(ctx); err != nil || n != 3 {
+		t.Errorf("CountUnassigned = %d, %v; want 3", n, err)
+	}
+
+	n, err := s.ClaimUnassigned(ctx, "g")
+	if err != nil || n != 2 {
+		t.Errorf("ClaimUnassigned = %d, %v; want 2", n, err)
+	}
+
+	if n, err := s.CountUnassigned(ctx); err != nil || n != 1 {
+		t.Errorf("CountUnassigned after claiming = %d, %v; want the conflicting basket", n, err)
+	}
+
+	if list, _ := s.ListDeadlines(ctx, "g"); len(list) != 1 || list[0].Title != "old" {
+		t.Errorf("ListDeadlines(g) = %+v, want old", list)
+	}
+	if baskets, _ := s.ListBaskets(ctx, "g"); len(baskets) != 2 {
+		t.Errorf("ListBaskets(g) = %+v, want links and notes", baskets)
+	}
+	if baskets, _ := s.ListBaskets(ctx, ""); len(baskets) != 1 || baskets[0].Name != "links" {
+		t.Errorf("conflicting basket was claimed, left: %+v", baskets)
+	}
+}
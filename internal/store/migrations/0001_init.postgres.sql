@@ -0,0 +1,31 @@
+-- Postgres version of the original schema. Times are RFC3339 UTC text, as in
+-- SQLite; the "C" collation keeps their ordering bytewise.
+
+CREATE TABLE IF NOT EXISTS deadlines(
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	due_at TEXT COLLATE "C" NOT NULL,
+	next_reminder TEXT COLLATE "C" NOT NULL,
+	next_remind_index INTEGER NOT NULL,
+	CHECK (
+		(next_remind_index >= 0)
+		OR
+		(next_remind_index = -1 AND next_reminder = due_at)
+	)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deadlines_next_reminder
+ON deadlines(next_reminder);
+
+CREATE TABLE IF NOT EXISTS baskets(
+	id SERIAL PRIMARY KEY,
+	name TEXT COLLATE "C" UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS pins(
+	id SERIAL PRIMARY KEY,
+	content TEXT NOT NULL,
+	basket_id INTEGER NOT NULL,
+	FOREIGN KEY(basket_id) REFERENCES baskets(id)
+		ON DELETE CASCADE
+);
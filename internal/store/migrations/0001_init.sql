@@ -0,0 +1,31 @@
+-- The schema from before migrations existed. IF NOT EXISTS lets databases
+-- created back then adopt it as their first version.
+
+CREATE TABLE IF NOT EXISTS deadlines(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	due_at TEXT NOT NULL,              -- RFC3339 UTC
+	next_reminder TEXT NOT NULL,       -- RFC3339 UTC
+	next_remind_index INTEGER NOT NULL,
+	CHECK (
+		(next_remind_index >= 0)
+		OR
+		(next_remind_index = -1 AND next_reminder = due_at)
+	)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deadlines_next_reminder
+ON deadlines(next_reminder);
+
+CREATE TABLE IF NOT EXISTS baskets(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS pins(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	content TEXT NOT NULL,
+	basket_id INTEGER NOT NULL,
+	FOREIGN KEY(basket_id) REFERENCES baskets(id)
+		ON DELETE CASCADE
+);
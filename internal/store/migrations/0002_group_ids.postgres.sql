@@ -0,0 +1,5 @@
+ALTER TABLE deadlines ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE baskets ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE baskets DROP CONSTRAINT baskets_name_key;
+ALTER TABLE baskets ADD CONSTRAINT baskets_group_id_name_key UNIQUE (group_id, name);
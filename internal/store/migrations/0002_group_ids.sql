@@ -0,0 +1,21 @@
+-- Scope deadlines and baskets to the group they belong to. Rows from before
+-- multi-group support get an empty group_id until Store.ClaimUnassigned hands
+-- them to a group.
+
+ALTER TABLE deadlines ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+
+-- Basket names become unique per group, which SQLite can only do by
+-- rebuilding the table.
+CREATE TABLE baskets_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	UNIQUE (group_id, name)
+);
+
+INSERT INTO baskets_new (id, name)
+SELECT id, name FROM baskets;
+
+DROP TABLE baskets;
+
+ALTER TABLE baskets_new RENAME TO baskets;
@@ -0,0 +1,2 @@
+ALTER TABLE deadlines ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';   -- see Recurrence.Rule
+ALTER TABLE deadlines ADD COLUMN repeat_until TEXT NOT NULL DEFAULT ''; -- RFC3339 UTC, empty for no end
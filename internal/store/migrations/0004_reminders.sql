@@ -0,0 +1,2 @@
+-- Existing deadlines keep the schedule that used to be hard-coded.
+ALTER TABLE deadlines ADD COLUMN reminders TEXT NOT NULL DEFAULT '1h,3h,6h,12h,1d,2d'; -- see FormatReminders
@@ -0,0 +1,15 @@
+CREATE TABLE outbox(
+	id SERIAL PRIMARY KEY,
+	key TEXT UNIQUE NOT NULL,
+	chat_id TEXT NOT NULL,
+	text TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered or dropped
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	next_attempt TEXT COLLATE "C" NOT NULL, -- RFC3339 UTC
+	created_at TEXT NOT NULL,               -- RFC3339 UTC
+	delivered_at TEXT                       -- RFC3339 UTC
+);
+
+CREATE INDEX idx_outbox_pending
+ON outbox(status, next_attempt);
@@ -0,0 +1,11 @@
+-- Full-text index of pin content for Store.SearchPins. Splitting on anything
+-- but letters and digits and the 'simple' configuration, which doesn't stem,
+-- find the same words as SQLite's unicode61 tokenizer; the default parser
+-- would keep URLs whole.
+
+ALTER TABLE pins ADD COLUMN search tsvector
+	GENERATED ALWAYS AS (
+		to_tsvector('simple', regexp_replace(content, '[^[:alnum:]]+', ' ', 'g'))
+	) STORED;
+
+CREATE INDEX idx_pins_search ON pins USING GIN (search);
@@ -0,0 +1,24 @@
+-- Full-text index of pin content for Store.SearchPins. It holds no copy of
+-- the text, only the index, and triggers keep it in step with pins.
+
+CREATE VIRTUAL TABLE pins_fts USING fts5(
+	content,
+	content = 'pins',
+	content_rowid = 'id',
+	tokenize = 'unicode61 remove_diacritics 0'
+);
+
+INSERT INTO pins_fts (pins_fts) VALUES ('rebuild');
+
+CREATE TRIGGER pins_fts_insert AFTER INSERT ON pins BEGIN
+	INSERT INTO pins_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER pins_fts_delete AFTER DELETE ON pins BEGIN
+	INSERT INTO pins_fts (pins_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER pins_fts_update AFTER UPDATE ON pins BEGIN
+	INSERT INTO pins_fts (pins_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	INSERT INTO pins_fts (rowid, content) VALUES (new.id, new.content);
+END;
@@ -0,0 +1,4 @@
+-- Pins made by replying to a message remember where they came from.
+ALTER TABLE pins ADD COLUMN source_id TEXT NOT NULL DEFAULT '';     -- chat message ID
+ALTER TABLE pins ADD COLUMN source_sender TEXT NOT NULL DEFAULT ''; -- sender's chat ID
+ALTER TABLE pins ADD COLUMN source_at TEXT NOT NULL DEFAULT '';     -- RFC3339 UTC, empty if unknown
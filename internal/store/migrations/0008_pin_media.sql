@@ -0,0 +1,5 @@
+-- Pins can carry a file, kept on disk under its SHA-256 (see package media).
+ALTER TABLE pins ADD COLUMN media_sha256 TEXT NOT NULL DEFAULT ''; -- empty for text pins
+ALTER TABLE pins ADD COLUMN media_kind TEXT NOT NULL DEFAULT '';   -- image, video, audio, document or sticker
+ALTER TABLE pins ADD COLUMN media_mime TEXT NOT NULL DEFAULT '';
+ALTER TABLE pins ADD COLUMN media_name TEXT NOT NULL DEFAULT '';   -- original file name, if any
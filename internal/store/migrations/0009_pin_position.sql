@@ -0,0 +1,5 @@
+-- Pins are listed by position within their basket, so they can be reordered.
+-- Existing pins keep their order by ID.
+ALTER TABLE pins ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+UPDATE pins SET position = id;
+CREATE INDEX idx_pins_position ON pins (basket_id, position);
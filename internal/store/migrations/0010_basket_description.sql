@@ -0,0 +1,2 @@
+-- Baskets can say what belongs in them.
+ALTER TABLE baskets ADD COLUMN description TEXT NOT NULL DEFAULT '';
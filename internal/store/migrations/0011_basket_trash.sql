@@ -0,0 +1,3 @@
+-- Deleted baskets go to a trash bin, pins and all, until they are restored or
+-- purged for good.
+ALTER TABLE baskets ADD COLUMN deleted_at TEXT NOT NULL DEFAULT ''; -- RFC3339 UTC, empty unless trashed
@@ -0,0 +1,8 @@
+-- Roles given with .role. Members without a row here get theirs from the
+-- chat: group admins are admins, everyone else a member.
+CREATE TABLE roles (
+	group_id TEXT NOT NULL,
+	user_id TEXT NOT NULL, -- phone number or LID, without server or device
+	role TEXT NOT NULL,    -- admin, moderator or member
+	PRIMARY KEY (group_id, user_id)
+);
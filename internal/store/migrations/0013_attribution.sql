@@ -0,0 +1,8 @@
+-- Deadlines and pins remember who created them and when, and who changed
+-- them last. Existing rows are left empty.
+ALTER TABLE deadlines ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE deadlines ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE deadlines ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE pins ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE pins ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE pins ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Changes made by commands, newest last, for .audit.
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_id TEXT NOT NULL,
+	actor TEXT NOT NULL,             -- phone number or LID, without server or device
+	command TEXT NOT NULL,           -- such as p edit
+	entity TEXT NOT NULL,            -- deadline, basket, pin or role
+	target TEXT NOT NULL,            -- ID or name of the entity
+	before_json TEXT NOT NULL DEFAULT '',
+	after_json TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL         -- RFC3339 UTC
+);
+
+CREATE INDEX idx_audit_log_group
+ON audit_log(group_id, id);
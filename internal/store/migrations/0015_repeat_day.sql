@@ -0,0 +1 @@
+ALTER TABLE deadlines ADD COLUMN repeat_day INTEGER NOT NULL DEFAULT 0; -- see Recurrence.Day
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrStaleDeadline is returned by ApplyDeadlineChanges when a deadline no
+// longer is in the state the change was computed from.
+var ErrStaleDeadline = errors.New("deadline changed since it was read")
+
+// OutboxMessage is a message waiting to be delivered, or being retried after
+// a failed delivery.
+type OutboxMessage struct {
+	ID int
+	// Key is random and unique per message, for transports that can use it
+	// to drop duplicate deliveries.
+	Key       string
+	Chat      string
+	Text      string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// DeadlineChange is an update the scheduler makes to a deadline after
+// handling one of its reminders. It only applies while the deadline still has
+// the NextReminder and NextRemindIndex of From, so the same reminder can never
+// be handled twice.
+type DeadlineChange struct {
+	From Deadline
+
+	// Delete removes the deadline, the other fields are then ignored.
+	Delete bool
+
+	// DueAt moves a repeating deadline to its next occurrence. Zero keeps
+	// the current due time.
+	DueAt           time.Time
+	NextReminder    time.Time
+	NextRemindIndex int
+}
+
+func newOutboxKey() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ApplyDeadlineChanges applies changes and queues messages for delivery in a
+// single transaction. If any change is stale nothing is applied and
+// ErrStaleDeadline is returned.
+func (dbs *DBStore) ApplyDeadlineChanges(ctx context.Context, changes []DeadlineChange, messages []OutboxMessage) error {
+	const deleteQuery = `
+		DELETE FROM deadlines
+		WHERE id = ? AND next_reminder = ? AND next_remind_index = ?;`
+
+	const updateQuery = `
+		UPDATE deadlines
+		SET
+			due_at = ?,
+			next_reminder = ?,
+			next_remind_index = ?
+		WHERE id = ? AND next_reminder = ? AND next_remind_index = ?;`
+
+	const insertQuery = `
+		INSERT INTO outbox (key, chat_id, text, next_attempt, created_at)
+		VALUES (?, ?, ?, ?, ?);`
+
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range changes {
+		var res sql.Result
+
+		from := c.From.NextReminder.UTC().Format(time.RFC3339)
+
+		if c.Delete {
+			res, err = tx.ExecContext(ctx, deleteQuery, c.From.ID, from, c.From.NextRemindIndex)
+		} else {
+			dueAt := c.DueAt
+			if dueAt.IsZero() {
+				dueAt = c.From.DueAt
+			}
+
+			res, err = tx.ExecContext(
+				ctx,
+				updateQuery,
+				dueAt.UTC().Format(time.RFC3339),
+				c.NextReminder.UTC().Format(time.RFC3339),
+				c.NextRemindIndex,
+				c.From.ID,
+				from,
+				c.From.NextRemindIndex,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		count, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return ErrStaleDeadline
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	for _, m := range messages {
+		key, err := newOutboxKey()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, insertQuery, key, m.Chat, m.Text, now, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PendingMessages returns undelivered messages to chats due for an attempt
+// at now, oldest first.
+func (dbs *DBStore) PendingMessages(ctx context.Context, chats []string, now time.Time) ([]OutboxMessage, error) {
+	cond, args := inGroups("chat_id", chats)
+	query := `
+		SELECT id, key, chat_id, text, attempts, created_at FROM outbox
+		WHERE status = 'pending' AND next_attempt <= ? AND ` + cond + `
+		ORDER BY id ASC;`
+
+	rows, err := dbs.db.QueryContext(ctx, query, append([]any{now.UTC().Format(time.RFC3339)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+
+	for rows.Next() {
+		var (
+			m            OutboxMessage
+			createdAtStr string
+		)
+
+		if err := rows.Scan(&m.ID, &m.Key, &m.Chat, &m.Text, &m.Attempts, &createdAtStr); err != nil {
+			return nil, err
+		}
+
+		m.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// NextDeliveryAt returns when the next pending message to chats is due for
+// an attempt, or false if there are none.
+func (dbs *DBStore) NextDeliveryAt(ctx context.Context, chats []string) (time.Time, bool, error) {
+	cond, args := inGroups("chat_id", chats)
+	query := `SELECT MIN(next_attempt) FROM outbox WHERE status = 'pending' AND ` + cond + `;`
+
+	var next sql.NullString
+	if err := dbs.db.QueryRowContext(ctx, query, args...).Scan(&next); err != nil {
+		return time.Time{}, false, err
+	}
+
+	if !next.Valid {
+		return time.Time{}, false, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, next.String)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return t, true, nil
+}
+
+func (dbs *DBStore) MarkDelivered(ctx context.Context, id int) error {
+	const query = `
+		UPDATE outbox
+		SET status = 'delivered', delivered_at = ?
+		WHERE id = ?;`
+
+	return dbs.execOutbox(ctx, query, time.Now().UTC().Format(time.RFC3339), id)
+}
+
+// MarkFailed records a failed delivery attempt. The message is retried at
+// retryAt, or dropped for good if retryAt is zero.
+func (dbs *DBStore) MarkFailed(ctx context.Context, id int, reason string, retryAt time.Time) error {
+	const retryQuery = `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, next_attempt = ?
+		WHERE id = ?;`
+
+	const dropQuery = `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, status = 'dropped'
+		WHERE id = ?;`
+
+	if retryAt.IsZero() {
+		return dbs.execOutbox(ctx, dropQuery, reason, id)
+	}
+
+	return dbs.execOutbox(ctx, retryQuery, reason, retryAt.UTC().Format(time.RFC3339), id)
+}
+
+func (dbs *DBStore) PruneOutbox(ctx context.Context, chats []string, cutoff time.Time) (int, error) {
+	cond, args := inGroups("chat_id", chats)
+	query := `
+		DELETE FROM outbox
+		WHERE status != 'pending' AND created_at < ? AND ` + cond + `;`
+
+	res, err := dbs.db.ExecContext(ctx, query, append([]any{cutoff.UTC().Format(time.RFC3339)}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (dbs *DBStore) execOutbox(ctx context.Context, query string, args ...any) error {
+	res, err := dbs.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
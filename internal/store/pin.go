@@ -3,57 +3,134 @@ package store
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"slices"
 	"strings"
+	"time"
 )
 
-func (dbs *DBStore) AddPin(ctx context.Context, basketName string, content string) (Pin, error) {
-	const query1 = `SELECT id FROM baskets WHERE name = ?`
-	const query2 = `
-		INSERT INTO pins (content, basket_id)
-		VALUES (?, ?);
-	`
+const pinColumns = `
+	p.id, p.content, p.source_id, p.source_sender, p.source_at,
+	p.media_sha256, p.media_kind, p.media_mime, p.media_name,
+	p.created_by, p.created_at, p.updated_by`
 
-	var basketID int
-	err := dbs.db.QueryRow(query1, strings.ToLower(basketName)).Scan(&basketID)
-	if err == sql.ErrNoRows {
-		return Pin{}, errors.New("basket does not exist")
+func scanPin(row rowScanner, dest ...any) (Pin, error) {
+	var (
+		p            Pin
+		sourceAtStr  string
+		createdAtStr string
+		err          error
+	)
+
+	if err := row.Scan(append([]any{
+		&p.ID,
+		&p.Content,
+		&p.Source.MessageID,
+		&p.Source.Sender,
+		&sourceAtStr,
+		&p.Media.SHA256,
+		&p.Media.Kind,
+		&p.Media.MIME,
+		&p.Media.Name,
+		&p.CreatedBy,
+		&createdAtStr,
+		&p.UpdatedBy,
+	}, dest...)...); err != nil {
+		return Pin{}, err
 	}
-	if err != nil {
+
+	if p.Source.SentAt, err = parseTime(sourceAtStr); err != nil {
+		return Pin{}, err
+	}
+	if p.CreatedAt, err = parseTime(createdAtStr); err != nil {
 		return Pin{}, err
 	}
 
-	res, err := dbs.db.ExecContext(ctx, query2, content, basketID)
+	return p, nil
+}
+
+// formatTime formats t for a TEXT column, leaving it empty if t is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTime reads a time written by formatTime.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (dbs *DBStore) AddPin(ctx context.Context, group string, basketName string, pin Pin) (Pin, error) {
+	const query = `
+		INSERT INTO pins (
+			content,
+			basket_id,
+			source_id,
+			source_sender,
+			source_at,
+			media_sha256,
+			media_kind,
+			media_mime,
+			media_name,
+			created_by,
+			created_at,
+			position
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (
+			SELECT COALESCE(MAX(position), 0) + 1 FROM pins WHERE basket_id = ?
+		))
+		RETURNING id;
+	`
+
+	basketID, err := dbs.basketID(ctx, group, basketName)
 	if err != nil {
 		return Pin{}, err
 	}
 
-	lastID, err := res.LastInsertId()
-	if err != nil {
+	pin.Basket = strings.ToLower(basketName)
+	pin.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	pin.UpdatedBy = ""
+
+	row := dbs.db.QueryRowContext(
+		ctx,
+		query,
+		pin.Content,
+		basketID,
+		pin.Source.MessageID,
+		pin.Source.Sender,
+		formatTime(pin.Source.SentAt),
+		pin.Media.SHA256,
+		pin.Media.Kind,
+		pin.Media.MIME,
+		pin.Media.Name,
+		pin.CreatedBy,
+		formatTime(pin.CreatedAt),
+		basketID,
+	)
+	if err := row.Scan(&pin.ID); err != nil {
 		return Pin{}, err
 	}
 
-	p := Pin{
-		ID:      int(lastID),
-		Content: content,
+	if !pin.Source.SentAt.IsZero() {
+		pin.Source.SentAt = pin.Source.SentAt.UTC().Truncate(time.Second)
 	}
 
-	return p, nil
+	return pin, nil
 }
-func (dbs *DBStore) ListPins(ctx context.Context, basketName string) ([]Pin, error) {
-	const query1 = "SELECT id FROM baskets WHERE name = ?"
-	const query2 = "SELECT id, content FROM pins WHERE basket_id = ? ORDER BY id ASC"
 
-	var basketID int
-	err := dbs.db.QueryRow(query1, basketName).Scan(&basketID)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("basket does not exist")
-	}
+func (dbs *DBStore) ListPins(ctx context.Context, group string, basketName string) ([]Pin, error) {
+	const query = "SELECT" + pinColumns + " FROM pins p WHERE p.basket_id = ? ORDER BY p.position ASC, p.id ASC"
+
+	basketID, err := dbs.basketID(ctx, group, basketName)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := dbs.db.QueryContext(ctx, query2, basketID)
+	rows, err := dbs.db.QueryContext(ctx, query, basketID)
 	if err != nil {
 		return nil, err
 	}
@@ -62,11 +139,11 @@ func (dbs *DBStore) ListPins(ctx context.Context, basketName string) ([]Pin, err
 	pins := []Pin{}
 
 	for rows.Next() {
-		var p Pin
-
-		if err := rows.Scan(&p.ID, &p.Content); err != nil {
+		p, err := scanPin(rows)
+		if err != nil {
 			return nil, err
 		}
+		p.Basket = strings.ToLower(basketName)
 
 		pins = append(pins, p)
 	}
@@ -78,12 +155,119 @@ func (dbs *DBStore) ListPins(ctx context.Context, basketName string) ([]Pin, err
 	return pins, nil
 }
 
-func (dbs *DBStore) DeletePin(ctx context.Context, id int) error {
+func (dbs *DBStore) GetPin(ctx context.Context, group string, id int) (Pin, error) {
+	const query = `
+		SELECT` + pinColumns + `, b.name FROM pins p
+		JOIN baskets b ON b.id = p.basket_id
+		WHERE p.id = ? AND b.group_id = ? AND b.deleted_at = '';`
+
+	var basket string
+	p, err := scanPin(dbs.db.QueryRowContext(ctx, query, id, group), &basket)
+	if err == sql.ErrNoRows {
+		return Pin{}, ErrPinNotFound
+	}
+	if err != nil {
+		return Pin{}, err
+	}
+	p.Basket = basket
+
+	return p, nil
+}
+
+func (dbs *DBStore) DeletePin(ctx context.Context, group string, id int) error {
+	const query = `
+		DELETE FROM pins
+		WHERE id = ? AND basket_id IN (
+			SELECT id FROM baskets WHERE group_id = ? AND deleted_at = ''
+		);
+	`
+	res, err := dbs.db.ExecContext(ctx, query, id, group)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrPinNotFound
+	}
+
+	return nil
+}
+
+func (dbs *DBStore) MediaInUse(ctx context.Context) ([]string, error) {
+	const query = `SELECT DISTINCT media_sha256 FROM pins WHERE media_sha256 != '';`
+
+	rows, err := dbs.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := []string{}
+	for rows.Next() {
+		var sum string
+		if err := rows.Scan(&sum); err != nil {
+			return nil, err
+		}
+		sums = append(sums, sum)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
+
+func (dbs *DBStore) EditPin(ctx context.Context, group string, id int, content string, by string) error {
 	const query = `
-		DELETE FROM pins 
-		WHERE id = ?;
+		UPDATE pins SET content = ?, updated_by = ?
+		WHERE id = ? AND basket_id IN (
+			SELECT id FROM baskets WHERE group_id = ? AND deleted_at = ''
+		);
 	`
-	res, err := dbs.db.ExecContext(ctx, query, id)
+	res, err := dbs.db.ExecContext(ctx, query, content, by, id, group)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrPinNotFound
+	}
+
+	return nil
+}
+
+func (dbs *DBStore) MovePin(ctx context.Context, group string, id int, basketName string, by string) error {
+	const query = `
+		UPDATE pins SET
+			basket_id = ?,
+			position = (SELECT COALESCE(MAX(position), 0) + 1 FROM pins WHERE basket_id = ?),
+			updated_by = ?
+		WHERE id = ? AND basket_id IN (
+			SELECT id FROM baskets WHERE group_id = ? AND deleted_at = ''
+		);
+	`
+
+	if _, err := dbs.GetPin(ctx, group, id); err != nil {
+		return err
+	}
+
+	basketID, err := dbs.basketID(ctx, group, basketName)
+	if err != nil {
+		return err
+	}
+
+	res, err := dbs.db.ExecContext(ctx, query, basketID, basketID, by, id, group)
 	if err != nil {
 		return err
 	}
@@ -94,8 +278,68 @@ func (dbs *DBStore) DeletePin(ctx context.Context, id int) error {
 	}
 
 	if affected == 0 {
-		return errors.New("pin does not exist")
+		return ErrPinNotFound
 	}
 
 	return nil
 }
+
+// SetPinPosition renumbers every pin of the basket, so positions stay 1, 2,
+// 3... however often pins are moved.
+func (dbs *DBStore) SetPinPosition(ctx context.Context, group string, id int, position int) error {
+	const basketQuery = `
+		SELECT p.basket_id FROM pins p
+		JOIN baskets b ON b.id = p.basket_id
+		WHERE p.id = ? AND b.group_id = ? AND b.deleted_at = '';`
+
+	const pinsQuery = `SELECT id FROM pins WHERE basket_id = ? ORDER BY position ASC, id ASC;`
+
+	const updateQuery = `UPDATE pins SET position = ? WHERE id = ?;`
+
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var basketID int
+	err = tx.QueryRowContext(ctx, basketQuery, id, group).Scan(&basketID)
+	if err == sql.ErrNoRows {
+		return ErrPinNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, pinsQuery, basketID)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var pinID int
+		if err := rows.Scan(&pinID); err != nil {
+			rows.Close()
+			return err
+		}
+		if pinID != id {
+			ids = append(ids, pinID)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ids = slices.Insert(ids, min(max(position, 1), len(ids)+1)-1, id)
+
+	for i, pinID := range ids {
+		if _, err := tx.ExecContext(ctx, updateQuery, i+1, pinID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
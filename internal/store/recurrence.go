@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence describes how a deadline repeats once it expires. Exactly one of
+// Days and Months is set for a repeating deadline; the zero value never
+// repeats.
+type Recurrence struct {
+	Days   int
+	Months int
+	// Day is the day of the month monthly repeats fall on, so that one
+	// clamped to the end of a short month moves back afterwards. Zero takes
+	// the day of the occurrence being repeated.
+	Day   int
+	Until time.Time // last allowed due time, zero for no end
+}
+
+// ParseRecurrence parses a repeat rule: daily, weekly, monthly, or an
+// interval such as 3d (every 3 days) or 2w (every 2 weeks).
+func ParseRecurrence(rule string) (Recurrence, error) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+
+	switch rule {
+	case "daily":
+		return Recurrence{Days: 1}, nil
+	case "weekly":
+		return Recurrence{Days: 7}, nil
+	case "monthly", "1m":
+		return Recurrence{Months: 1}, nil
+	}
+
+	if len(rule) < 2 {
+		return Recurrence{}, fmt.Errorf("invalid repeat rule %q", rule)
+	}
+
+	n, err := strconv.Atoi(rule[:len(rule)-1])
+	if err != nil || n <= 0 {
+		return Recurrence{}, fmt.Errorf("invalid repeat rule %q", rule)
+	}
+
+	switch rule[len(rule)-1] {
+	case 'd':
+		return Recurrence{Days: n}, nil
+	case 'w':
+		return Recurrence{Days: 7 * n}, nil
+	case 'm':
+		return Recurrence{Months: n}, nil
+	}
+
+	return Recurrence{}, fmt.Errorf("invalid repeat rule %q", rule)
+}
+
+func (r Recurrence) Repeats() bool {
+	return r.Days > 0 || r.Months > 0
+}
+
+// Rule returns the rule in the form accepted by ParseRecurrence, or "" if r
+// does not repeat.
+func (r Recurrence) Rule() string {
+	switch {
+	case r.Months > 0:
+		return strconv.Itoa(r.Months) + "m"
+	case r.Days > 0:
+		return strconv.Itoa(r.Days) + "d"
+	}
+	return ""
+}
+
+func (r Recurrence) String() string {
+	switch {
+	case r.Months == 1:
+		return "monthly"
+	case r.Months > 1:
+		return fmt.Sprintf("every %d months", r.Months)
+	case r.Days == 1:
+		return "daily"
+	case r.Days == 7:
+		return "weekly"
+	case r.Days > 0 && r.Days%7 == 0:
+		return fmt.Sprintf("every %d weeks", r.Days/7)
+	case r.Days > 0:
+		return fmt.Sprintf("every %d days", r.Days)
+	}
+	return "never"
+}
+
+// anchored returns r with Day set to the day due falls on, for monthly
+// repeats.
+func (r Recurrence) anchored(due time.Time, tz *time.Location) Recurrence {
+	if r.Months > 0 {
+		r.Day = due.In(tz).Day()
+	}
+	return r
+}
+
+// Next returns the first occurrence after due. Intervals are added in the
+// given timezone so the wall clock time stays the same across DST changes,
+// and monthly deadlines falling on a day the target month lacks move to its
+// last day. The second result is false when r does not repeat or the next
+// occurrence would be after r.Until.
+func (r Recurrence) Next(due time.Time, tz *time.Location) (time.Time, bool) {
+	if !r.Repeats() {
+		return time.Time{}, false
+	}
+
+	local := due.In(tz)
+
+	var next time.Time
+	if r.Months > 0 {
+		day := r.Day
+		if day == 0 {
+			day = local.Day()
+		}
+
+		// Start from the first of the month, as AddDate would normalise
+		// Jan 31 + 1 month to Mar 3, and clamp to the month's last day.
+		first := time.Date(local.Year(), local.Month()+time.Month(r.Months), 1,
+			local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), tz)
+		last := first.AddDate(0, 1, -1).Day()
+		next = first.AddDate(0, 0, min(day, last)-1)
+	} else {
+		next = local.AddDate(0, 0, r.Days)
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, false
+	}
+
+	return next.UTC(), true
+}
+
+func parseUntil(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid repeat end date")
+	}
+
+	return t, nil
+}
+
+func formatUntil(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
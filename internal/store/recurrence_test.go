@@ -0,0 +1,108 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Recurrence
+		wantErr bool
+	}{
+		{"daily", Recurrence{Days: 1}, false},
+		{"Weekly", Recurrence{Days: 7}, false},
+		{"monthly", Recurrence{Months: 1}, false},
+		{"3d", Recurrence{Days: 3}, false},
+		{"2w", Recurrence{Days: 14}, false},
+		{"6m", Recurrence{Months: 6}, false},
+		{"0d", Recurrence{}, true},
+		{"-1d", Recurrence{}, true},
+		{"d", Recurrence{}, true},
+		{"3h", Recurrence{}, true},
+		{"yearly", Recurrence{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRecurrence(tt.in)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecurrence(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ParseRecurrence(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+
+			if !tt.wantErr {
+				again, err := ParseRecurrence(got.Rule())
+				if err != nil || again != got {
+					t.Fatalf("Rule() %q does not round trip", got.Rule())
+				}
+			}
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	tz, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+
+	local := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name   string
+		rec    Recurrence
+		due    time.Time
+		want   time.Time
+		wantOK bool
+	}{
+		{"no repeat", Recurrence{}, local("2025-01-06 23:59"), time.Time{}, false},
+		{"daily", Recurrence{Days: 1}, local("2025-01-06 23:59"), local("2025-01-07 23:59"), true},
+		{"weekly", Recurrence{Days: 7}, local("2025-01-06 23:59"), local("2025-01-13 23:59"), true},
+		{"weekly across DST", Recurrence{Days: 7}, local("2025-03-27 09:00"), local("2025-04-03 09:00"), true},
+		{"monthly", Recurrence{Months: 1}, local("2025-01-15 10:00"), local("2025-02-15 10:00"), true},
+		{"monthly clamps to month end", Recurrence{Months: 1}, local("2025-01-31 10:00"), local("2025-02-28 10:00"), true},
+		{"monthly returns to its day", Recurrence{Months: 1, Day: 31}, local("2025-02-28 10:00"), local("2025-03-31 10:00"), true},
+		{"monthly across DST", Recurrence{Months: 1, Day: 15}, local("2025-03-15 09:00"), local("2025-04-15 09:00"), true},
+		{"until allows last", Recurrence{Days: 7, Until: local("2025-01-13 23:59")}, local("2025-01-06 23:59"), local("2025-01-13 23:59"), true},
+		{"until stops", Recurrence{Days: 7, Until: local("2025-01-12 23:59")}, local("2025-01-06 23:59"), time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.rec.Next(tt.due.UTC(), tz)
+
+			if ok != tt.wantOK {
+				t.Fatalf("Next() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if ok && !got.Equal(tt.want) {
+				t.Fatalf("Next() = %v, want %v", got.In(tz), tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNextKeepsDay(t *testing.T) {
+	rec := Recurrence{Months: 1}.anchored(time.Date(2025, time.January, 31, 10, 0, 0, 0, time.UTC), time.UTC)
+
+	due := time.Date(2025, time.January, 31, 10, 0, 0, 0, time.UTC)
+	for _, want := range []string{"2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31"} {
+		var ok bool
+		due, ok = rec.Next(due, time.UTC)
+		if !ok || due.Format(time.DateOnly) != want {
+			t.Fatalf("Next() = %v, %v; want %s", due, ok, want)
+		}
+	}
+}
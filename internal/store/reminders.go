@@ -0,0 +1,113 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultReminderSchedule is used for new deadlines when no schedule is
+// configured. A schedule lists how long before the due time each reminder is
+// sent, shortest first.
+var DefaultReminderSchedule = []time.Duration{
+	1 * time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	48 * time.Hour,
+}
+
+// ParseReminders parses a comma separated list of reminder offsets such as
+// "7d,3d,1d,1h" or "90m". Days (d) and weeks (w) are accepted on top of the
+// units time.ParseDuration knows. "none" yields an empty schedule, meaning
+// only the expiry notice is sent. The result is sorted shortest first with
+// duplicates removed.
+func ParseReminders(s string) ([]time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "none" {
+		return []time.Duration{}, nil
+	}
+
+	var offsets []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		d, err := parseOffset(field)
+		if err != nil {
+			return nil, err
+		}
+
+		offsets = append(offsets, d)
+	}
+
+	slices.Sort(offsets)
+	return slices.Compact(offsets), nil
+}
+
+func parseOffset(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	var (
+		d   time.Duration
+		err error
+	)
+	if unit > 0 {
+		var n int
+		n, err = strconv.Atoi(s[:len(s)-1])
+		d = time.Duration(n) * unit
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid reminder %q, use e.g. 3d, 12h or 30m", s)
+	}
+
+	return d, nil
+}
+
+// FormatReminders is the inverse of ParseReminders.
+func FormatReminders(offsets []time.Duration) string {
+	if len(offsets) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, len(offsets))
+	for i, d := range offsets {
+		parts[i] = formatOffset(d)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func formatOffset(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	case d%time.Hour == 0:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d%time.Minute == 0:
+		return strconv.Itoa(int(d/time.Minute)) + "m"
+	}
+	return d.String()
+}
+
+func computeInitialReminder(dueAt, now time.Time, schedule []time.Duration) (time.Time, int) {
+	for i := len(schedule) - 1; i >= 0; i-- {
+		t := dueAt.Add(-schedule[i])
+		if t.After(now) {
+			return t, i
+		}
+	}
+	// No reminders left → next event is expiration
+	return dueAt, -1
+}
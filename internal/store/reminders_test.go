@@ -0,0 +1,48 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseReminders(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []time.Duration
+		format  string
+		wantErr bool
+	}{
+		{"1h", []time.Duration{time.Hour}, "1h", false},
+		{"7d,3d,1d", []time.Duration{24 * time.Hour, 72 * time.Hour, 168 * time.Hour}, "1d,3d,7d", false},
+		{"1w, 90m", []time.Duration{90 * time.Minute, 168 * time.Hour}, "90m,7d", false},
+		{"1d,24h", []time.Duration{24 * time.Hour}, "1d", false},
+		{"none", []time.Duration{}, "none", false},
+		{"", nil, "", true},
+		{"0h", nil, "", true},
+		{"-1d", nil, "", true},
+		{"3x", nil, "", true},
+		{"1d,,2d", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseReminders(tt.in)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReminders(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("ParseReminders(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+
+			if f := FormatReminders(got); f != tt.format {
+				t.Fatalf("FormatReminders(%v) = %q, want %q", got, f, tt.format)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Role decides which commands a group member may run.
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// roleRanks lists the roles from least to most privileged.
+var roleRanks = []Role{RoleMember, RoleModerator, RoleAdmin}
+
+// ParseRole parses a role name, ignoring case.
+func ParseRole(s string) (Role, error) {
+	r := Role(strings.ToLower(s))
+	if !slices.Contains(roleRanks, r) {
+		return "", fmt.Errorf("invalid role %q, use admin, moderator or member", s)
+	}
+	return r, nil
+}
+
+// AtLeast reports whether r is as privileged as other or more.
+func (r Role) AtLeast(other Role) bool {
+	return slices.Index(roleRanks, r) >= slices.Index(roleRanks, other)
+}
+
+// ErrRoleNotSet is returned by ClearRole for members without a role.
+var ErrRoleNotSet = errors.New("no role was set for this member")
+
+// RoleAssignment is a role given to a member of a group.
+type RoleAssignment struct {
+	User string
+	Role Role
+}
+
+func (dbs *DBStore) GetRole(ctx context.Context, group string, user string) (Role, bool, error) {
+	const query = `SELECT role FROM roles WHERE group_id = ? AND user_id = ?;`
+
+	var role Role
+	err := dbs.db.QueryRowContext(ctx, query, group, user).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return role, true, nil
+}
+
+func (dbs *DBStore) SetRole(ctx context.Context, group string, user string, role Role) error {
+	const query = `
+		INSERT INTO roles (group_id, user_id, role)
+		VALUES (?, ?, ?)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = excluded.role;`
+
+	_, err := dbs.db.ExecContext(ctx, query, group, user, role)
+	return err
+}
+
+func (dbs *DBStore) ClearRole(ctx context.Context, group string, user string) error {
+	const query = `DELETE FROM roles WHERE group_id = ? AND user_id = ?;`
+
+	res, err := dbs.db.ExecContext(ctx, query, group, user)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrRoleNotSet
+	}
+
+	return nil
+}
+
+func (dbs *DBStore) ListRoles(ctx context.Context, group string) ([]RoleAssignment, error) {
+	const query = `
+		SELECT user_id, role FROM roles
+		WHERE group_id = ?
+		ORDER BY user_id ASC;`
+
+	rows, err := dbs.db.QueryContext(ctx, query, group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []RoleAssignment{}
+
+	for rows.Next() {
+		var r RoleAssignment
+
+		if err := rows.Scan(&r.User, &r.Role); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
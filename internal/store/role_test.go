@@ -0,0 +1,43 @@
+package store
+
+import "testing"
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Role
+		wantErr bool
+	}{
+		{"admin", RoleAdmin, false},
+		{"Moderator", RoleModerator, false},
+		{"MEMBER", RoleMember, false},
+		{"owner", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRole(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRole(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		r, other Role
+		want     bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleMember, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleMember, RoleModerator, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", tt.r, tt.other, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ErrEmptySearch is returned by SearchPins for a query without any words.
+var ErrEmptySearch = errors.New("nothing to search for")
+
+// PinMatch is a pin found by SearchPins.
+type PinMatch struct {
+	Pin
+	// Snippet is the pin's content, shortened around the first match if it
+	// is long, with matched words between asterisks.
+	Snippet string
+}
+
+// Snippets longer than this many characters are shortened.
+const snippetLength = 160
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// searchTerms splits query into the lower case words a pin must contain,
+// dropping duplicates. Pins match words that start with a term.
+func searchTerms(query string) ([]string, error) {
+	var terms []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool { return !isWordRune(r) }) {
+		if !slices.Contains(terms, w) {
+			terms = append(terms, w)
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	return terms, nil
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, t := range terms {
+		if strings.HasPrefix(word, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight returns content with every word matching terms between
+// asterisks, cut down to about snippetLength characters around the first
+// match. It is done here rather than by the database so every store marks
+// the same words.
+func highlight(content string, terms []string) string {
+	runes := []rune(content)
+
+	type span struct{ start, end int }
+	var matches []span
+
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+
+		if matchesTerm(string(runes[i:j]), terms) {
+			matches = append(matches, span{i, j})
+		}
+		i = j
+	}
+
+	from, to := 0, len(runes)
+	if len(runes) > snippetLength {
+		if len(matches) > 0 {
+			from = max(0, matches[0].start-snippetLength/4)
+		}
+		to = min(len(runes), from+snippetLength)
+
+		// Don't cut words in half.
+		for from > 0 && from < len(runes) && isWordRune(runes[from-1]) {
+			from++
+		}
+		for to < len(runes) && to > from && isWordRune(runes[to]) {
+			to--
+		}
+		for from < to && unicode.IsSpace(runes[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(runes[to-1]) {
+			to--
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(string(runes[pos:m.start]))
+		b.WriteString("*" + string(runes[m.start:m.end]) + "*")
+		pos = m.end
+	}
+	b.WriteString(string(runes[pos:to]))
+
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// SearchPins uses SQLite's FTS5 index or Postgres text search to find and
+// rank pins.
+func (dbs *DBStore) SearchPins(ctx context.Context, group string, basket string, query string, limit int) ([]PinMatch, error) {
+	terms, err := searchTerms(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		q    string
+		args []any
+	)
+
+	// Terms are letters and digits only, so they need no escaping.
+	if dbs.driver == Postgres {
+		prefixes := make([]string, len(terms))
+		for i, t := range terms {
+			prefixes[i] = t + ":*"
+		}
+		args = append(args, strings.Join(prefixes, " & "))
+		q = `
+			SELECT` + pinColumns + `, b.name
+			FROM pins p
+			JOIN baskets b ON b.id = p.basket_id,
+			to_tsquery('simple', ?) query
+			WHERE p.search @@ query AND b.group_id = ? AND b.deleted_at = ''`
+	} else {
+		prefixes := make([]string, len(terms))
+		for i, t := range terms {
+			prefixes[i] = `"` + t + `"*`
+		}
+		args = append(args, strings.Join(prefixes, " "))
+		q = `
+			SELECT` + pinColumns + `, b.name
+			FROM pins_fts
+			JOIN pins p ON p.id = pins_fts.rowid
+			JOIN baskets b ON b.id = p.basket_id
+			WHERE pins_fts MATCH ? AND b.group_id = ? AND b.deleted_at = ''`
+	}
+	args = append(args, group)
+
+	if basket != "" {
+		basket = strings.ToLower(basket)
+		if _, err := dbs.basketID(ctx, group, basket); err != nil {
+			return nil, err
+		}
+
+		q += ` AND b.name = ?`
+		args = append(args, basket)
+	}
+
+	if dbs.driver == Postgres {
+		q += ` ORDER BY ts_rank(p.search, query) DESC, p.id ASC LIMIT ?;`
+	} else {
+		q += ` ORDER BY bm25(pins_fts) ASC, p.id ASC LIMIT ?;`
+	}
+	args = append(args, limit)
+
+	rows, err := dbs.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []PinMatch{}
+
+	for rows.Next() {
+		var (
+			m      PinMatch
+			basket string
+		)
+		m.Pin, err = scanPin(rows, &basket)
+		if err != nil {
+			return nil, err
+		}
+		m.Basket = basket
+
+		m.Snippet = highlight(m.Content, terms)
+		matches = append(matches, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
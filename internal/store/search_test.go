@@ -0,0 +1,52 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Go", "go"},
+		{"exam  Notes", "exam notes"},
+		{"go.dev/tour", "go dev tour"},
+		{"go GO go", "go"},
+		{"naïve café", "naïve café"},
+	}
+
+	for _, tt := range tests {
+		got, err := searchTerms(tt.in)
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("searchTerms(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := searchTerms(" -- "); err != ErrEmptySearch {
+		t.Errorf("searchTerms without words = %v, want ErrEmptySearch", err)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("filler ", 40) + "the exam is on friday " + strings.Repeat("more ", 40)
+
+	tests := []struct {
+		content string
+		terms   []string
+		want    string
+	}{
+		{"Read chapter 3", []string{"chap"}, "Read *chapter* 3"},
+		{"Go, go and GOLANG", []string{"go"}, "*Go*, *go* and *GOLANG*"},
+		{"ago is not a match", []string{"go"}, "ago is not a match"},
+		{"Café au lait", []string{"café"}, "*Café* au lait"},
+		{long, []string{"exam"}, "…filler filler filler filler filler the *exam* is on friday " + strings.TrimSpace(strings.Repeat("more ", 20)) + "…"},
+	}
+
+	for _, tt := range tests {
+		if got := highlight(tt.content, tt.terms); got != tt.want {
+			t.Errorf("highlight(%q, %q) =\n%q\nwant\n%q", tt.content, tt.terms, got, tt.want)
+		}
+	}
+}
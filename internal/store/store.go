@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -9,38 +10,183 @@ const DisplayFormat = "Mon, Jan 2 at 3:04 PM"
 
 type Deadline struct {
 	ID              int
+	GroupID         string
 	Title           string
 	DueAt           time.Time
 	NextReminder    time.Time
 	NextRemindIndex int
+	Reminders       []time.Duration // offsets before DueAt, shortest first
+	Recurrence      Recurrence
+	Attribution
+}
+
+// Attribution says who created a deadline or pin, and who changed it last.
+// Users are phone numbers or LIDs, without server or device. Everything is
+// empty for rows made before it was recorded.
+type Attribution struct {
+	CreatedBy string
+	CreatedAt time.Time
+	UpdatedBy string // empty if it was never edited
+}
+
+// ReminderAfter returns the first reminder of d scheduled after now and its
+// index, or DueAt and -1 if only the expiry is left.
+func (d Deadline) ReminderAfter(now time.Time) (time.Time, int) {
+	return computeInitialReminder(d.DueAt, now, d.Reminders)
+}
+
+type Basket struct {
+	Name        string
+	Description string
+	Pins        int       // number of pins in the basket
+	DeletedAt   time.Time // when it was put in the trash, zero if it isn't
 }
 
 type Pin struct {
 	ID      int
+	Basket  string // name of the basket holding the pin
 	Content string
+	// Source is the chat message the pin was made from, if it was pinned by
+	// replying to one.
+	Source PinSource
+	// Media is the file attached to the pin, if any. Content is then its
+	// caption and may be empty.
+	Media PinMedia
+	Attribution
 }
 
-type Basket struct {
-	Name      string
-	Pins      []Pin
-	NextPinID int
+// PinMedia describes a file attached to a pin. The file itself is kept
+// outside the store, under its SHA-256.
+type PinMedia struct {
+	SHA256 string
+	Kind   string // image, video, audio, document or sticker
+	MIME   string
+	Name   string // original file name, if any
+}
+
+// IsZero reports whether there is no file.
+func (m PinMedia) IsZero() bool {
+	return m.SHA256 == ""
 }
 
+// PinSource identifies the chat message a pin was taken from.
+type PinSource struct {
+	MessageID string
+	Sender    string    // chat ID of the original sender
+	SentAt    time.Time // zero if unknown
+}
+
+// IsZero reports whether the pin has no source.
+func (src PinSource) IsZero() bool {
+	return src.MessageID == ""
+}
+
+// Errors shared by every Store implementation. Their messages are shown to
+// users as they are.
+var (
+	ErrDeadlineNotFound = errors.New("deadline does not exist")
+	ErrBasketNotFound   = errors.New("basket does not exist")
+	ErrBasketExists     = errors.New("basket already exists")
+	ErrBasketInTrash    = errors.New("a basket with this name is in the trash")
+	ErrNotInTrash       = errors.New("basket is not in the trash")
+	ErrPinNotFound      = errors.New("pin does not exist")
+	ErrMessageNotFound  = errors.New("message not found")
+)
+
+// Store keeps the data of every group the bot serves. Methods taking a group
+// only see and modify rows belonging to that group.
 type Store interface {
-	AddDeadline(ctx context.Context, title string, duaAt time.Time) (Deadline, error)
-	ListDeadlines(ctx context.Context) ([]Deadline, error)
-	DeleteDeadline(ctx context.Context, id int) error
+	// AddDeadline, UpdateDeadline and SetReminders record by as the user
+	// who created or last changed the deadline.
+	AddDeadline(ctx context.Context, group string, title string, duaAt time.Time, reminders []time.Duration, rec Recurrence, by string) (Deadline, error)
+	ListDeadlines(ctx context.Context, group string) ([]Deadline, error)
+	GetDeadline(ctx context.Context, group string, id int) (Deadline, error)
+	UpdateDeadline(ctx context.Context, group string, id int, title string, dueAt time.Time, by string) (Deadline, error)
+	SetReminders(ctx context.Context, group string, id int, reminders []time.Duration, by string) (Deadline, error)
+	DeleteDeadline(ctx context.Context, group string, id int) error
+
+	// ListDueDeadlines returns due deadlines of groups, or of all groups if
+	// groups is empty.
+	ListDueDeadlines(ctx context.Context, groups []string, now time.Time) ([]Deadline, error)
+	// NextReminderAt returns the earliest next_reminder of the deadlines of
+	// groups (all if empty), or false if there are none.
+	NextReminderAt(ctx context.Context, groups []string) (time.Time, bool, error)
+	// Changes receives a value after deadlines are added, edited or deleted.
+	// It is meant for a single listener.
+	Changes() <-chan struct{}
+
+	// ApplyDeadlineChanges atomically applies scheduler changes to deadlines
+	// and queues the messages announcing them.
+	ApplyDeadlineChanges(ctx context.Context, changes []DeadlineChange, messages []OutboxMessage) error
+	// PendingMessages and NextDeliveryAt are limited to messages to chats,
+	// or see every chat if it is empty.
+	PendingMessages(ctx context.Context, chats []string, now time.Time) ([]OutboxMessage, error)
+	NextDeliveryAt(ctx context.Context, chats []string) (time.Time, bool, error)
+	MarkDelivered(ctx context.Context, id int) error
+	MarkFailed(ctx context.Context, id int, reason string, retryAt time.Time) error
+	// PruneOutbox deletes delivered and dropped messages to chats (all if
+	// empty) queued before cutoff, returning how many it deleted.
+	PruneOutbox(ctx context.Context, chats []string, cutoff time.Time) (int, error)
+
+	AddBasket(ctx context.Context, group string, name string) error
+	ListBaskets(ctx context.Context, group string) ([]Basket, error)
+	// DeleteBasket moves a basket and its pins to the trash. Trashed baskets
+	// and their pins are left out everywhere except ListTrash, but still keep
+	// their name taken.
+	DeleteBasket(ctx context.Context, group string, name string) error
+	// ListTrash returns the trashed baskets of group, most recent first.
+	ListTrash(ctx context.Context, group string) ([]Basket, error)
+	RestoreBasket(ctx context.Context, group string, name string) error
+	// PurgeTrash deletes baskets trashed before cutoff for good, in groups or
+	// in all groups if it is empty.
+	PurgeTrash(ctx context.Context, groups []string, cutoff time.Time) (int, error)
+	// RenameBasket renames a basket, keeping its pins.
+	RenameBasket(ctx context.Context, group string, name string, newName string) error
+	SetBasketDescription(ctx context.Context, group string, name string, description string) error
 
-	ListDueDeadlines(ctx context.Context, now time.Time) ([]Deadline, error)
-	UpdateNextReminder(ctx context.Context, id int, nextTime time.Time, nextIndex int) error
+	// AddPin adds pin to a basket, ignoring its ID. Of its Attribution only
+	// CreatedBy is kept; CreatedAt is set to now.
+	AddPin(ctx context.Context, group string, basketName string, pin Pin) (Pin, error)
+	ListPins(ctx context.Context, group string, basketName string) ([]Pin, error)
+	GetPin(ctx context.Context, group string, id int) (Pin, error)
+	DeletePin(ctx context.Context, group string, id int) error
+	// EditPin replaces the content of a pin, keeping its file and source.
+	// It and MovePin record by as the user who last changed the pin.
+	EditPin(ctx context.Context, group string, id int, content string, by string) error
+	// MovePin moves a pin to the end of another basket of the same group.
+	MovePin(ctx context.Context, group string, id int, basketName string, by string) error
+	// SetPinPosition moves a pin to position (1 is first) in the order
+	// ListPins returns the pins of its basket. Positions past the end move it
+	// last.
+	SetPinPosition(ctx context.Context, group string, id int, position int) error
+	// SearchPins finds the pins of group containing every word of query, in
+	// basket or in all baskets if basket is empty. Words match by prefix and
+	// case-insensitively. The best matches come first, at most limit of them.
+	SearchPins(ctx context.Context, group string, basket string, query string, limit int) ([]PinMatch, error)
+	// MediaInUse returns the SHA-256 of every file a pin refers to, in any
+	// group and including pins in the trash.
+	MediaInUse(ctx context.Context) ([]string, error)
 
-	AddBasket(ctx context.Context, name string) error
-	ListBaskets(ctx context.Context) ([]string, error)
-	DeleteBasket(ctx context.Context, name string) error
+	// GetRole returns the role given to user in group, or false if there is
+	// none. Users are phone numbers or LIDs, without server or device.
+	GetRole(ctx context.Context, group string, user string) (Role, bool, error)
+	SetRole(ctx context.Context, group string, user string, role Role) error
+	ClearRole(ctx context.Context, group string, user string) error
+	ListRoles(ctx context.Context, group string) ([]RoleAssignment, error)
 
-	AddPin(ctx context.Context, basketName string, content string) (Pin, error)
-	ListPins(ctx context.Context, basketName string) ([]Pin, error)
-	DeletePin(ctx context.Context, id int) error
+	// AddAuditEntry records a change in group, ignoring the ID and At of
+	// entry. At is set to now.
+	AddAuditEntry(ctx context.Context, group string, entry AuditEntry) (AuditEntry, error)
+	// ListAuditEntries returns the latest limit entries of group, newest
+	// first.
+	ListAuditEntries(ctx context.Context, group string, limit int) ([]AuditEntry, error)
+	// WithAudit makes a change and records it in group as AddAuditEntry does,
+	// together: change is given a Store to make it with and returns the entry,
+	// and if it or recording the entry fails nothing it did is kept. change
+	// must not use any other Store, and may be run again if the transaction
+	// conflicts with another. An entry whose Before and After are the same
+	// records no change, and is left out.
+	WithAudit(ctx context.Context, group string, change func(s Store) (AuditEntry, error)) error
 
 	Timezone() *time.Location
 }
@@ -0,0 +1,1140 @@
+// Package storetest checks that a store.Store implementation behaves like the
+// others, so the bot can run against any of them.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaezrr/remy-bot/internal/store"
+)
+
+// Run runs the conformance tests against stores made by open. Every call to
+// open must return a new, empty store.
+func Run(t *testing.T, open func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{"Deadlines", testDeadlines},
+		{"DeadlinesPerGroup", testDeadlinesPerGroup},
+		{"DueDeadlines", testDueDeadlines},
+		{"ApplyDeadlineChanges", testApplyDeadlineChanges},
+		{"Outbox", testOutbox},
+		{"Baskets", testBaskets},
+		{"EditBaskets", testEditBaskets},
+		{"Trash", testTrash},
+		{"Pins", testPins},
+		{"EditPins", testEditPins},
+		{"Attribution", testAttribution},
+		{"PinPositions", testPinPositions},
+		{"SearchPins", testSearchPins},
+		{"Roles", testRoles},
+		{"Audit", testAudit},
+		{"WithAudit", testWithAudit},
+		{"Changes", testChanges},
+		{"Errors", testErrors},
+		{"Ordering", testOrdering},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// The store keeps times to the second.
+func at(d time.Duration) time.Time {
+	return time.Now().UTC().Add(d).Truncate(time.Second)
+}
+
+func titles(deadlines []store.Deadline) []string {
+	var out []string
+	for _, d := range deadlines {
+		out = append(out, d.Title)
+	}
+	return out
+}
+
+func testDeadlines(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	reminders := []time.Duration{time.Hour, 24 * time.Hour}
+	rec := store.Recurrence{Days: 7, Until: at(30 * 24 * time.Hour)}
+
+	later, err := s.AddDeadline(ctx, "g", "later", at(72*time.Hour), reminders, rec, "")
+	if err != nil {
+		t.Fatalf("AddDeadline: %v", err)
+	}
+	sooner, err := s.AddDeadline(ctx, "g", "sooner", at(48*time.Hour), nil, store.Recurrence{}, "")
+	if err != nil {
+		t.Fatalf("AddDeadline: %v", err)
+	}
+	if later.ID == sooner.ID {
+		t.Fatalf("deadlines share ID %d", later.ID)
+	}
+
+	got, err := s.GetDeadline(ctx, "g", later.ID)
+	if err != nil {
+		t.Fatalf("GetDeadline: %v", err)
+	}
+	if got.Title != "later" || !got.DueAt.Equal(later.DueAt) || got.GroupID != "g" {
+		t.Errorf("GetDeadline = %+v, want %+v", got, later)
+	}
+	if !slices.Equal(got.Reminders, reminders) {
+		t.Errorf("Reminders = %v, want %v", got.Reminders, reminders)
+	}
+	if got.Recurrence.Rule() != rec.Rule() || !got.Recurrence.Until.Equal(rec.Until) {
+		t.Errorf("Recurrence = %+v, want %+v", got.Recurrence, rec)
+	}
+	if got.NextReminder.After(got.DueAt) {
+		t.Errorf("NextReminder %v after DueAt %v", got.NextReminder, got.DueAt)
+	}
+
+	list, err := s.ListDeadlines(ctx, "g")
+	if err != nil {
+		t.Fatalf("ListDeadlines: %v", err)
+	}
+	if want := []string{"sooner", "later"}; !slices.Equal(titles(list), want) {
+		t.Errorf("ListDeadlines = %v, want %v", titles(list), want)
+	}
+
+	newDue := at(96 * time.Hour)
+	updated, err := s.UpdateDeadline(ctx, "g", sooner.ID, "renamed", newDue, "")
+	if err != nil {
+		t.Fatalf("UpdateDeadline: %v", err)
+	}
+	if updated.ID != sooner.ID || updated.Title != "renamed" || !updated.DueAt.Equal(newDue) {
+		t.Errorf("UpdateDeadline = %+v", updated)
+	}
+
+	tz := s.Timezone()
+	monthly, err := s.AddDeadline(ctx, "g", "rent", at(48*time.Hour), nil, store.Recurrence{Months: 1}, "")
+	if err != nil {
+		t.Fatalf("AddDeadline(monthly): %v", err)
+	}
+	if got, _ := s.GetDeadline(ctx, "g", monthly.ID); got.Recurrence.Day != monthly.DueAt.In(tz).Day() {
+		t.Errorf("monthly Recurrence = %+v, want the day of %v", got.Recurrence, monthly.DueAt)
+	}
+	updated, err = s.UpdateDeadline(ctx, "g", monthly.ID, "rent", newDue, "")
+	if err != nil || updated.Recurrence.Day != newDue.In(tz).Day() {
+		t.Errorf("UpdateDeadline(monthly) = %+v, %v; want the day of %v", updated.Recurrence, err, newDue)
+	}
+
+	updated, err = s.SetReminders(ctx, "g", later.ID, []time.Duration{}, "")
+	if err != nil {
+		t.Fatalf("SetReminders: %v", err)
+	}
+	if len(updated.Reminders) != 0 || !updated.NextReminder.Equal(updated.DueAt) {
+		t.Errorf("SetReminders(none) = %+v, want only the due reminder", updated)
+	}
+
+	if err := s.DeleteDeadline(ctx, "g", later.ID); err != nil {
+		t.Fatalf("DeleteDeadline: %v", err)
+	}
+	if _, err := s.GetDeadline(ctx, "g", later.ID); err == nil {
+		t.Error("GetDeadline after delete succeeded")
+	}
+	if err := s.DeleteDeadline(ctx, "g", later.ID); err == nil {
+		t.Error("DeleteDeadline twice succeeded")
+	}
+}
+
+func testDeadlinesPerGroup(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	d, err := s.AddDeadline(ctx, "a", "essay", at(48*time.Hour), nil, store.Recurrence{}, "")
+	if err != nil {
+		t.Fatalf("AddDeadline: %v", err)
+	}
+
+	if list, err := s.ListDeadlines(ctx, "b"); err != nil || len(list) != 0 {
+		t.Errorf("ListDeadlines(b) = %v, %v; want none", titles(list), err)
+	}
+	if _, err := s.GetDeadline(ctx, "b", d.ID); err == nil {
+		t.Error("GetDeadline from another group succeeded")
+	}
+	if _, err := s.UpdateDeadline(ctx, "b", d.ID, "x", at(time.Hour), ""); err == nil {
+		t.Error("UpdateDeadline from another group succeeded")
+	}
+	if err := s.DeleteDeadline(ctx, "b", d.ID); err == nil {
+		t.Error("DeleteDeadline from another group succeeded")
+	}
+}
+
+func testDueDeadlines(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if _, ok, err := s.NextReminderAt(ctx, nil); err != nil || ok {
+		t.Fatalf("NextReminderAt on empty store = %v, %v; want none", ok, err)
+	}
+
+	reminders := []time.Duration{time.Hour}
+	a, _ := s.AddDeadline(ctx, "a", "a", at(2*time.Hour), reminders, store.Recurrence{}, "")
+	b, _ := s.AddDeadline(ctx, "b", "b", at(3*time.Hour), reminders, store.Recurrence{}, "")
+
+	next, ok, err := s.NextReminderAt(ctx, nil)
+	if err != nil || !ok || !next.Equal(a.NextReminder) {
+		t.Errorf("NextReminderAt = %v, %v, %v; want %v", next, ok, err, a.NextReminder)
+	}
+	next, ok, err = s.NextReminderAt(ctx, []string{"b"})
+	if err != nil || !ok || !next.Equal(b.NextReminder) {
+		t.Errorf("NextReminderAt(b) = %v, %v, %v; want %v", next, ok, err, b.NextReminder)
+	}
+
+	due, err := s.ListDueDeadlines(ctx, nil, now)
+	if err != nil || len(due) != 0 {
+		t.Errorf("ListDueDeadlines(now) = %v, %v; want none", titles(due), err)
+	}
+
+	due, err = s.ListDueDeadlines(ctx, nil, now.Add(4*time.Hour))
+	if want := []string{"a", "b"}; err != nil || !slices.Equal(titles(due), want) {
+		t.Errorf("ListDueDeadlines = %v, %v; want %v", titles(due), err, want)
+	}
+
+	due, err = s.ListDueDeadlines(ctx, []string{"b", "c"}, now.Add(4*time.Hour))
+	if want := []string{"b"}; err != nil || !slices.Equal(titles(due), want) {
+		t.Errorf("ListDueDeadlines(b, c) = %v, %v; want %v", titles(due), err, want)
+	}
+}
+
+func testApplyDeadlineChanges(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	d, _ := s.AddDeadline(ctx, "g", "essay", at(48*time.Hour), []time.Duration{time.Hour, 24 * time.Hour}, store.Recurrence{}, "")
+	gone, _ := s.AddDeadline(ctx, "g", "quiz", at(24*time.Hour), nil, store.Recurrence{}, "")
+
+	next := at(47 * time.Hour)
+	changes := []store.DeadlineChange{
+		{From: d, NextReminder: next, NextRemindIndex: d.NextRemindIndex + 1},
+		{From: gone, Delete: true},
+	}
+	messages := []store.OutboxMessage{{Chat: "g", Text: "essay is due"}}
+
+	if err := s.ApplyDeadlineChanges(ctx, changes, messages); err != nil {
+		t.Fatalf("ApplyDeadlineChanges: %v", err)
+	}
+
+	got, err := s.GetDeadline(ctx, "g", d.ID)
+	if err != nil {
+		t.Fatalf("GetDeadline: %v", err)
+	}
+	if !got.NextReminder.Equal(next) || got.NextRemindIndex != d.NextRemindIndex+1 || !got.DueAt.Equal(d.DueAt) {
+		t.Errorf("after change = %+v", got)
+	}
+	if _, err := s.GetDeadline(ctx, "g", gone.ID); err == nil {
+		t.Error("deleted deadline still exists")
+	}
+
+	// d is stale now, so nothing in this batch may apply.
+	moved := at(100 * time.Hour)
+	changes = []store.DeadlineChange{
+		{From: got, DueAt: moved, NextReminder: moved, NextRemindIndex: -1},
+		{From: d, NextReminder: next, NextRemindIndex: d.NextRemindIndex + 1},
+	}
+	err = s.ApplyDeadlineChanges(ctx, changes, []store.OutboxMessage{{Chat: "g", Text: "twice"}})
+	if !errors.Is(err, store.ErrStaleDeadline) {
+		t.Fatalf("stale ApplyDeadlineChanges = %v, want ErrStaleDeadline", err)
+	}
+
+	if after, _ := s.GetDeadline(ctx, "g", d.ID); !after.DueAt.Equal(d.DueAt) {
+		t.Errorf("stale batch was partly applied: %+v", after)
+	}
+
+	pending, err := s.PendingMessages(ctx, nil, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PendingMessages: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Text != "essay is due" {
+		t.Errorf("PendingMessages = %+v, want only the first batch's message", pending)
+	}
+}
+
+func testOutbox(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	messages := []store.OutboxMessage{
+		{Chat: "a", Text: "first"},
+		{Chat: "b", Text: "second"},
+	}
+	if err := s.ApplyDeadlineChanges(ctx, nil, messages); err != nil {
+		t.Fatalf("ApplyDeadlineChanges: %v", err)
+	}
+
+	soon := time.Now().Add(time.Minute)
+
+	pending, err := s.PendingMessages(ctx, nil, soon)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("PendingMessages = %+v, %v; want 2", pending, err)
+	}
+	first, second := pending[0], pending[1]
+	if first.Text != "first" || second.Text != "second" {
+		t.Errorf("PendingMessages order = %q, %q", first.Text, second.Text)
+	}
+	if first.Key == "" || first.Key == second.Key {
+		t.Errorf("keys %q and %q are not unique", first.Key, second.Key)
+	}
+
+	if pending, _ := s.PendingMessages(ctx, []string{"b"}, soon); len(pending) != 1 || pending[0].Chat != "b" {
+		t.Errorf("PendingMessages(b) = %+v", pending)
+	}
+
+	if _, ok, err := s.NextDeliveryAt(ctx, []string{"c"}); err != nil || ok {
+		t.Errorf("NextDeliveryAt(c) = %v, %v; want none", ok, err)
+	}
+
+	if err := s.MarkDelivered(ctx, first.ID); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+
+	retryAt := at(time.Hour)
+	if err := s.MarkFailed(ctx, second.ID, "offline", retryAt); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+
+	if pending, _ := s.PendingMessages(ctx, nil, soon); len(pending) != 0 {
+		t.Errorf("PendingMessages after delivery and failure = %+v, want none", pending)
+	}
+
+	next, ok, err := s.NextDeliveryAt(ctx, nil)
+	if err != nil || !ok || !next.Equal(retryAt) {
+		t.Errorf("NextDeliveryAt = %v, %v, %v; want %v", next, ok, err, retryAt)
+	}
+
+	pending, _ = s.PendingMessages(ctx, nil, retryAt)
+	if len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("PendingMessages at retry = %+v, want second with 1 attempt", pending)
+	}
+
+	if err := s.MarkFailed(ctx, second.ID, "gave up", time.Time{}); err != nil {
+		t.Fatalf("MarkFailed(drop): %v", err)
+	}
+	if _, ok, _ := s.NextDeliveryAt(ctx, nil); ok {
+		t.Error("dropped message is still pending")
+	}
+
+	if err := s.MarkDelivered(ctx, 12345); err == nil {
+		t.Error("MarkDelivered of unknown message succeeded")
+	}
+
+	if err := s.ApplyDeadlineChanges(ctx, nil, []store.OutboxMessage{{Chat: "a", Text: "third"}}); err != nil {
+		t.Fatalf("ApplyDeadlineChanges: %v", err)
+	}
+
+	if n, err := s.PruneOutbox(ctx, nil, at(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PruneOutbox(an hour ago) = %d, %v; want 0", n, err)
+	}
+	if n, err := s.PruneOutbox(ctx, []string{"b"}, soon); err != nil || n != 1 {
+		t.Errorf("PruneOutbox(b) = %d, %v; want the dropped message", n, err)
+	}
+	if n, err := s.PruneOutbox(ctx, nil, soon); err != nil || n != 1 {
+		t.Errorf("PruneOutbox = %d, %v; want the delivered message", n, err)
+	}
+	if pending, _ := s.PendingMessages(ctx, nil, soon); len(pending) != 1 || pending[0].Text != "third" {
+		t.Errorf("PendingMessages after pruning = %+v, want third", pending)
+	}
+}
+
+func testBaskets(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	for _, name := range []string{"Notes", "links"} {
+		if err := s.AddBasket(ctx, "g", name); err != nil {
+			t.Fatalf("AddBasket(%s): %v", name, err)
+		}
+	}
+
+	if err := s.AddBasket(ctx, "g", "NOTES"); err == nil {
+		t.Error("AddBasket of a duplicate succeeded")
+	}
+	if err := s.AddBasket(ctx, "other", "notes"); err != nil {
+		t.Errorf("AddBasket in another group: %v", err)
+	}
+
+	baskets, err := s.ListBaskets(ctx, "g")
+	if want := []string{"links", "notes"}; err != nil || !slices.Equal(basketNames(baskets), want) {
+		t.Errorf("ListBaskets = %v, %v; want %v", basketNames(baskets), err, want)
+	}
+
+	if err := s.DeleteBasket(ctx, "g", "LINKS"); err != nil {
+		t.Fatalf("DeleteBasket: %v", err)
+	}
+	if err := s.DeleteBasket(ctx, "g", "links"); err == nil {
+		t.Error("DeleteBasket twice succeeded")
+	}
+
+	if baskets, _ := s.ListBaskets(ctx, "other"); !slices.Equal(basketNames(baskets), []string{"notes"}) {
+		t.Errorf("ListBaskets(other) = %v", basketNames(baskets))
+	}
+}
+
+func basketNames(baskets []store.Basket) []string {
+	var out []string
+	for _, b := range baskets {
+		out = append(out, b.Name)
+	}
+	return out
+}
+
+func testEditBaskets(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "notes")
+	s.AddBasket(ctx, "g", "links")
+	s.AddBasket(ctx, "other", "notes")
+	p, _ := s.AddPin(ctx, "g", "notes", store.Pin{Content: "x"})
+	s.AddPin(ctx, "g", "notes", store.Pin{Content: "y"})
+
+	if err := s.RenameBasket(ctx, "g", "Notes", "Lectures"); err != nil {
+		t.Fatalf("RenameBasket: %v", err)
+	}
+	if err := s.SetBasketDescription(ctx, "g", "lectures", "Slides and recordings"); err != nil {
+		t.Fatalf("SetBasketDescription: %v", err)
+	}
+
+	baskets, _ := s.ListBaskets(ctx, "g")
+	want := []store.Basket{
+		{Name: "lectures", Description: "Slides and recordings", Pins: 2},
+		{Name: "links"},
+	}
+	if !slices.Equal(baskets, want) {
+		t.Errorf("ListBaskets = %+v, want %+v", baskets, want)
+	}
+
+	// Pins stay with the renamed basket.
+	if pins, err := s.ListPins(ctx, "g", "lectures"); err != nil || len(pins) != 2 || pins[0].ID != p.ID {
+		t.Errorf("ListPins(lectures) = %v, %v; want the basket's 2 pins", pinIDs(pins), err)
+	}
+	if matches, _ := s.SearchPins(ctx, "g", "", "x", 10); len(matches) != 1 || matches[0].Basket != "lectures" {
+		t.Errorf("SearchPins after rename = %+v, want a match in lectures", matches)
+	}
+
+	if err := s.RenameBasket(ctx, "g", "lectures", "LINKS"); !errors.Is(err, store.ErrBasketExists) {
+		t.Errorf("RenameBasket to a taken name = %v, want ErrBasketExists", err)
+	}
+	if err := s.RenameBasket(ctx, "g", "links", "Links"); err != nil {
+		t.Errorf("RenameBasket to the same name: %v", err)
+	}
+	if err := s.RenameBasket(ctx, "other", "lectures", "x"); !errors.Is(err, store.ErrBasketNotFound) {
+		t.Errorf("RenameBasket in another group = %v, want ErrBasketNotFound", err)
+	}
+	if baskets, _ := s.ListBaskets(ctx, "other"); !slices.Equal(baskets, []store.Basket{{Name: "notes"}}) {
+		t.Errorf("ListBaskets(other) = %+v, want notes untouched", baskets)
+	}
+
+	if err := s.SetBasketDescription(ctx, "g", "lectures", ""); err != nil {
+		t.Fatalf("SetBasketDescription to clear: %v", err)
+	}
+	if baskets, _ := s.ListBaskets(ctx, "g"); baskets[0].Description != "" {
+		t.Errorf("cleared description = %q", baskets[0].Description)
+	}
+}
+
+func testTrash(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "notes")
+	s.AddBasket(ctx, "g", "links")
+	s.AddBasket(ctx, "other", "notes")
+	p, _ := s.AddPin(ctx, "g", "notes", store.Pin{Content: "lecture 1"})
+	s.AddPin(ctx, "g", "notes", store.Pin{Content: "lecture 2"})
+
+	before := at(-time.Second)
+	if err := s.DeleteBasket(ctx, "g", "Notes"); err != nil {
+		t.Fatalf("DeleteBasket: %v", err)
+	}
+
+	if baskets, _ := s.ListBaskets(ctx, "g"); !slices.Equal(basketNames(baskets), []string{"links"}) {
+		t.Errorf("ListBaskets = %v, want the trashed basket left out", basketNames(baskets))
+	}
+	if _, err := s.ListPins(ctx, "g", "notes"); !errors.Is(err, store.ErrBasketNotFound) {
+		t.Errorf("ListPins of a trashed basket = %v, want ErrBasketNotFound", err)
+	}
+	if _, err := s.GetPin(ctx, "g", p.ID); !errors.Is(err, store.ErrPinNotFound) {
+		t.Errorf("GetPin in a trashed basket = %v, want ErrPinNotFound", err)
+	}
+	if matches, _ := s.SearchPins(ctx, "g", "", "lecture", 10); len(matches) != 0 {
+		t.Errorf("SearchPins found %+v in the trash", matches)
+	}
+	if err := s.MovePin(ctx, "g", p.ID, "links", ""); !errors.Is(err, store.ErrPinNotFound) {
+		t.Errorf("MovePin out of the trash = %v, want ErrPinNotFound", err)
+	}
+
+	trash, err := s.ListTrash(ctx, "g")
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("ListTrash = %+v, %v; want notes", trash, err)
+	}
+	if trash[0].Name != "notes" || trash[0].Pins != 2 || trash[0].DeletedAt.Before(before) || trash[0].DeletedAt.After(at(time.Second)) {
+		t.Errorf("ListTrash = %+v, want notes with 2 pins deleted just now", trash[0])
+	}
+	if trash, _ := s.ListTrash(ctx, "other"); len(trash) != 0 {
+		t.Errorf("ListTrash(other) = %+v", trash)
+	}
+
+	// The name stays taken while the basket is in the trash.
+	if err := s.AddBasket(ctx, "g", "notes"); !errors.Is(err, store.ErrBasketInTrash) {
+		t.Errorf("AddBasket of a trashed name = %v, want ErrBasketInTrash", err)
+	}
+	if err := s.RenameBasket(ctx, "g", "links", "notes"); !errors.Is(err, store.ErrBasketInTrash) {
+		t.Errorf("RenameBasket to a trashed name = %v, want ErrBasketInTrash", err)
+	}
+
+	if err := s.RestoreBasket(ctx, "g", "NOTES"); err != nil {
+		t.Fatalf("RestoreBasket: %v", err)
+	}
+	if pins, _ := s.ListPins(ctx, "g", "notes"); len(pins) != 2 {
+		t.Errorf("restored basket has %d pins, want 2", len(pins))
+	}
+	if err := s.RestoreBasket(ctx, "g", "notes"); !errors.Is(err, store.ErrNotInTrash) {
+		t.Errorf("RestoreBasket twice = %v, want ErrNotInTrash", err)
+	}
+
+	// Purging only removes baskets trashed before the cutoff, in the given
+	// groups.
+	s.DeleteBasket(ctx, "g", "notes")
+	s.DeleteBasket(ctx, "other", "notes")
+
+	if n, err := s.PurgeTrash(ctx, nil, at(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PurgeTrash of old baskets = %d, %v; want 0", n, err)
+	}
+	if n, err := s.PurgeTrash(ctx, []string{"g"}, at(time.Hour)); err != nil || n != 1 {
+		t.Errorf("PurgeTrash(g) = %d, %v; want 1", n, err)
+	}
+	if trash, _ := s.ListTrash(ctx, "g"); len(trash) != 0 {
+		t.Errorf("ListTrash after purge = %+v", trash)
+	}
+	if trash, _ := s.ListTrash(ctx, "other"); len(trash) != 1 {
+		t.Errorf("other group's trash = %+v, want it left alone", trash)
+	}
+
+	// Purged baskets are gone for good, so their name is free again.
+	if err := s.AddBasket(ctx, "g", "notes"); err != nil {
+		t.Fatalf("AddBasket after purge: %v", err)
+	}
+	if pins, _ := s.ListPins(ctx, "g", "notes"); len(pins) != 0 {
+		t.Errorf("new basket has %d pins, want the purged ones gone", len(pins))
+	}
+}
+
+func testPins(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	if _, err := s.AddPin(ctx, "g", "missing", store.Pin{Content: "x"}); err == nil {
+		t.Error("AddPin to a missing basket succeeded")
+	}
+
+	s.AddBasket(ctx, "g", "links")
+
+	a, err := s.AddPin(ctx, "g", "Links", store.Pin{Content: "https://a.example"})
+	if err != nil {
+		t.Fatalf("AddPin: %v", err)
+	}
+	b, _ := s.AddPin(ctx, "g", "links", store.Pin{Content: "https://b.example"})
+
+	pins, err := s.ListPins(ctx, "g", "LINKS")
+	if err != nil {
+		t.Fatalf("ListPins: %v", err)
+	}
+	if len(pins) != 2 || pins[0] != a || pins[1] != b {
+		t.Errorf("ListPins = %+v, want %+v", pins, []store.Pin{a, b})
+	}
+
+	got, err := s.GetPin(ctx, "g", b.ID)
+	if err != nil || got != b {
+		t.Errorf("GetPin = %+v, %v; want %+v", got, err, b)
+	}
+	if _, err := s.GetPin(ctx, "other", b.ID); !errors.Is(err, store.ErrPinNotFound) {
+		t.Errorf("GetPin from another group = %v, want ErrPinNotFound", err)
+	}
+
+	src := store.PinSource{MessageID: "3EB0C1", Sender: "911234567890@s.whatsapp.net", SentAt: at(-time.Hour)}
+	file := store.PinMedia{SHA256: "ab12", Kind: "document", MIME: "application/pdf", Name: "slides.pdf"}
+	quoted, err := s.AddPin(ctx, "g", "links", store.Pin{Source: src, Media: file})
+	if err != nil {
+		t.Fatalf("AddPin with source: %v", err)
+	}
+	got, _ = s.GetPin(ctx, "g", quoted.ID)
+	if got.Source.MessageID != src.MessageID || got.Source.Sender != src.Sender || !got.Source.SentAt.Equal(src.SentAt) {
+		t.Errorf("Source = %+v, want %+v", got.Source, src)
+	}
+	if got.Media != file || got.Content != "" {
+		t.Errorf("GetPin = %+v, want media %+v and no content", got, file)
+	}
+	if !a.Source.IsZero() {
+		t.Errorf("pin added without source has %+v", a.Source)
+	}
+	if sums, err := s.MediaInUse(ctx); err != nil || !slices.Equal(sums, []string{"ab12"}) {
+		t.Errorf("MediaInUse = %v, %v; want [ab12]", sums, err)
+	}
+	s.DeletePin(ctx, "g", quoted.ID)
+	if sums, err := s.MediaInUse(ctx); err != nil || len(sums) != 0 {
+		t.Errorf("MediaInUse after delete = %v, %v; want none", sums, err)
+	}
+
+	if err := s.DeletePin(ctx, "other", a.ID); err == nil {
+		t.Error("DeletePin from another group succeeded")
+	}
+	if err := s.DeletePin(ctx, "g", a.ID); err != nil {
+		t.Fatalf("DeletePin: %v", err)
+	}
+
+	// Pins of a trashed basket are out of reach until it is restored.
+	s.DeleteBasket(ctx, "g", "links")
+	if err := s.DeletePin(ctx, "g", b.ID); err == nil {
+		t.Error("pin of a trashed basket was deleted")
+	}
+	s.RestoreBasket(ctx, "g", "links")
+	if got, err := s.GetPin(ctx, "g", b.ID); err != nil || got != b {
+		t.Errorf("GetPin after restore = %+v, %v; want %+v", got, err, b)
+	}
+}
+
+func pinIDs(pins []store.Pin) []int {
+	var out []int
+	for _, p := range pins {
+		out = append(out, p.ID)
+	}
+	return out
+}
+
+func testEditPins(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "links")
+	s.AddBasket(ctx, "g", "notes")
+	s.AddBasket(ctx, "other", "notes")
+
+	file := store.PinMedia{SHA256: "ab12", Kind: "image", MIME: "image/png"}
+	p, _ := s.AddPin(ctx, "g", "links", store.Pin{Content: "https://go.dev/tuor", Media: file})
+	n, _ := s.AddPin(ctx, "g", "notes", store.Pin{Content: "first note"})
+
+	if err := s.EditPin(ctx, "g", p.ID, "https://go.dev/tour", ""); err != nil {
+		t.Fatalf("EditPin: %v", err)
+	}
+	got, _ := s.GetPin(ctx, "g", p.ID)
+	if got.Content != "https://go.dev/tour" || got.Media != file {
+		t.Errorf("edited pin = %+v, want new content and the same file", got)
+	}
+	if err := s.EditPin(ctx, "other", p.ID, "x", ""); !errors.Is(err, store.ErrPinNotFound) {
+		t.Errorf("EditPin from another group = %v, want ErrPinNotFound", err)
+	}
+
+	// Search sees the new content.
+	if matches, _ := s.SearchPins(ctx, "g", "", "tour", 10); len(matches) != 1 {
+		t.Errorf("SearchPins(tour) after edit = %+v, want the edited pin", matches)
+	}
+	if matches, _ := s.SearchPins(ctx, "g", "", "tuor", 10); len(matches) != 0 {
+		t.Errorf("SearchPins(tuor) after edit = %+v, want nothing", matches)
+	}
+
+	if err := s.MovePin(ctx, "g", p.ID, "Notes", ""); err != nil {
+		t.Fatalf("MovePin: %v", err)
+	}
+	links, _ := s.ListPins(ctx, "g", "links")
+	notes, _ := s.ListPins(ctx, "g", "notes")
+	if len(links) != 0 || !slices.Equal(pinIDs(notes), []int{n.ID, p.ID}) {
+		t.Errorf("after MovePin links = %v, notes = %v; want [] and [%d %d]", pinIDs(links), pinIDs(notes), n.ID, p.ID)
+	}
+	if matches, _ := s.SearchPins(ctx, "g", "notes", "tour", 10); len(matches) != 1 || matches[0].Basket != "notes" {
+		t.Errorf("SearchPins in notes after move = %+v, want the moved pin", matches)
+	}
+	if got, _ := s.GetPin(ctx, "g", p.ID); got.Basket != "notes" {
+		t.Errorf("GetPin after move is in basket %q, want notes", got.Basket)
+	}
+
+	if err := s.MovePin(ctx, "g", p.ID, "missing", ""); !errors.Is(err, store.ErrBasketNotFound) {
+		t.Errorf("MovePin to a missing basket = %v, want ErrBasketNotFound", err)
+	}
+	if err := s.MovePin(ctx, "other", p.ID, "notes", ""); !errors.Is(err, store.ErrPinNotFound) {
+		t.Errorf("MovePin from another group = %v, want ErrPinNotFound", err)
+	}
+	if notes, _ := s.ListPins(ctx, "other", "notes"); len(notes) != 0 {
+		t.Errorf("other group's basket = %v, want no pins", pinIDs(notes))
+	}
+}
+
+func testAttribution(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Second)
+
+	d, err := s.AddDeadline(ctx, "g", "essay", at(48*time.Hour), nil, store.Recurrence{}, "alice")
+	if err != nil {
+		t.Fatalf("AddDeadline: %v", err)
+	}
+	if d.CreatedBy != "alice" || d.CreatedAt.Before(before) || d.CreatedAt.After(time.Now()) || d.UpdatedBy != "" {
+		t.Errorf("added deadline attribution = %+v, want created by alice now", d.Attribution)
+	}
+	if got, _ := s.GetDeadline(ctx, "g", d.ID); got.Attribution != d.Attribution {
+		t.Errorf("GetDeadline attribution = %+v, want %+v", got.Attribution, d.Attribution)
+	}
+
+	if _, err := s.UpdateDeadline(ctx, "g", d.ID, "long essay", d.DueAt, "bob"); err != nil {
+		t.Fatalf("UpdateDeadline: %v", err)
+	}
+	if list, _ := s.ListDeadlines(ctx, "g"); len(list) != 1 || list[0].CreatedBy != "alice" || !list[0].CreatedAt.Equal(d.CreatedAt) || list[0].UpdatedBy != "bob" {
+		t.Errorf("ListDeadlines after update = %+v, want created by alice and updated by bob", list)
+	}
+	if got, _ := s.SetReminders(ctx, "g", d.ID, nil, "carol"); got.UpdatedBy != "carol" {
+		t.Errorf("SetReminders attribution = %+v, want updated by carol", got.Attribution)
+	}
+
+	s.AddBasket(ctx, "g", "notes")
+	s.AddBasket(ctx, "g", "links")
+
+	// Only CreatedBy is taken from the caller.
+	p, err := s.AddPin(ctx, "g", "notes", store.Pin{
+		Content:     "slides",
+		Attribution: store.Attribution{CreatedBy: "alice", CreatedAt: at(-time.Hour), UpdatedBy: "mallory"},
+	})
+	if err != nil {
+		t.Fatalf("AddPin: %v", err)
+	}
+	if p.CreatedBy != "alice" || p.CreatedAt.Before(before) || p.UpdatedBy != "" {
+		t.Errorf("added pin attribution = %+v, want created by alice now", p.Attribution)
+	}
+	if got, _ := s.GetPin(ctx, "g", p.ID); got.Attribution != p.Attribution {
+		t.Errorf("GetPin attribution = %+v, want %+v", got.Attribution, p.Attribution)
+	}
+
+	if err := s.EditPin(ctx, "g", p.ID, "lecture slides", "bob"); err != nil {
+		t.Fatalf("EditPin: %v", err)
+	}
+	if pins, _ := s.ListPins(ctx, "g", "notes"); len(pins) != 1 || pins[0].CreatedBy != "alice" || pins[0].UpdatedBy != "bob" {
+		t.Errorf("ListPins after edit = %+v, want created by alice and updated by bob", pins)
+	}
+
+	if err := s.MovePin(ctx, "g", p.ID, "links", "carol"); err != nil {
+		t.Fatalf("MovePin: %v", err)
+	}
+	matches, _ := s.SearchPins(ctx, "g", "", "slides", 10)
+	if len(matches) != 1 || matches[0].CreatedBy != "alice" || !matches[0].CreatedAt.Equal(p.CreatedAt) || matches[0].UpdatedBy != "carol" {
+		t.Errorf("SearchPins after move = %+v, want created by alice and updated by carol", matches)
+	}
+}
+
+func testPinPositions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "links")
+	s.AddBasket(ctx, "g", "notes")
+
+	var ids []int
+	for _, c := range []string{"a", "b", "c", "d"} {
+		p, _ := s.AddPin(ctx, "g", "links", store.Pin{Content: c})
+		ids = append(ids, p.ID)
+	}
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	tests := []struct {
+		id, position int
+		want         []int
+	}{
+		{d, 1, []int{d, a, b, c}},
+		{d, 3, []int{a, b, d, c}},
+		{a, 10, []int{b, d, c, a}},
+		{c, 0, []int{c, b, d, a}},
+		{b, 2, []int{c, b, d, a}},
+	}
+
+	for _, tt := range tests {
+		if err := s.SetPinPosition(ctx, "g", tt.id, tt.position); err != nil {
+			t.Fatalf("SetPinPosition(%d, %d): %v", tt.id, tt.position, err)
+		}
+		pins, _ := s.ListPins(ctx, "g", "links")
+		if got := pinIDs(pins); !slices.Equal(got, tt.want) {
+			t.Errorf("after SetPinPosition(%d, %d) order = %v, want %v", tt.id, tt.position, got, tt.want)
+		}
+	}
+
+	// New and moved pins go last.
+	e, _ := s.AddPin(ctx, "g", "links", store.Pin{Content: "e"})
+	s.AddPin(ctx, "g", "notes", store.Pin{Content: "n"})
+	s.MovePin(ctx, "g", c, "notes", "")
+	s.MovePin(ctx, "g", c, "links", "")
+	pins, _ := s.ListPins(ctx, "g", "links")
+	if want := []int{b, d, a, e.ID, c}; !slices.Equal(pinIDs(pins), want) {
+		t.Errorf("order after adding and moving = %v, want %v", pinIDs(pins), want)
+	}
+}
+
+func testSearchPins(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "links")
+	s.AddBasket(ctx, "g", "notes")
+	s.AddBasket(ctx, "other", "links")
+
+	once, _ := s.AddPin(ctx, "g", "links", store.Pin{Content: "Go tour: https://go.dev/tour"})
+	often, _ := s.AddPin(ctx, "g", "notes", store.Pin{Content: "go go go, the exam covers Go channels"})
+	s.AddPin(ctx, "g", "notes", store.Pin{Content: "unrelated shopping list"})
+	s.AddPin(ctx, "other", "links", store.Pin{Content: "go somewhere else"})
+
+	matches, err := s.SearchPins(ctx, "g", "", "GO", 10)
+	if err != nil {
+		t.Fatalf("SearchPins: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != often.ID || matches[1].ID != once.ID {
+		t.Fatalf("SearchPins(go) = %+v, want #%d then #%d", matches, often.ID, once.ID)
+	}
+	if matches[0].Basket != "notes" || matches[1].Basket != "links" {
+		t.Errorf("baskets = %q, %q", matches[0].Basket, matches[1].Basket)
+	}
+	if want := "*Go* tour: https://*go*.dev/tour"; matches[1].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", matches[1].Snippet, want)
+	}
+
+	// Words match by prefix, and every word must match.
+	matches, _ = s.SearchPins(ctx, "g", "", "chan exam", 10)
+	if len(matches) != 1 || matches[0].ID != often.ID {
+		t.Errorf("SearchPins(chan exam) = %+v, want #%d", matches, often.ID)
+	}
+	if want := "go go go, the *exam* covers Go *channels*"; len(matches) == 1 && matches[0].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", matches[0].Snippet, want)
+	}
+	if matches, _ := s.SearchPins(ctx, "g", "", "go nowhere", 10); len(matches) != 0 {
+		t.Errorf("SearchPins(go nowhere) = %+v, want none", matches)
+	}
+
+	matches, _ = s.SearchPins(ctx, "g", "Links", "go", 10)
+	if len(matches) != 1 || matches[0].ID != once.ID {
+		t.Errorf("SearchPins in links = %+v, want #%d", matches, once.ID)
+	}
+
+	if matches, _ := s.SearchPins(ctx, "g", "", "go", 1); len(matches) != 1 {
+		t.Errorf("SearchPins with limit 1 returned %d", len(matches))
+	}
+
+	if _, err := s.SearchPins(ctx, "g", "missing", "go", 10); !errors.Is(err, store.ErrBasketNotFound) {
+		t.Errorf("SearchPins in missing basket = %v", err)
+	}
+	if _, err := s.SearchPins(ctx, "g", "", " ?! ", 10); !errors.Is(err, store.ErrEmptySearch) {
+		t.Errorf("SearchPins without words = %v", err)
+	}
+
+	// The index follows pins being deleted, with their basket too.
+	s.DeletePin(ctx, "g", once.ID)
+	s.DeleteBasket(ctx, "g", "notes")
+	if matches, _ := s.SearchPins(ctx, "g", "", "go", 10); len(matches) != 0 {
+		t.Errorf("SearchPins after deletes = %+v, want none", matches)
+	}
+}
+
+func testRoles(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	if _, ok, err := s.GetRole(ctx, "g", "911"); ok || err != nil {
+		t.Errorf("GetRole without a role = %v, %v; want false", ok, err)
+	}
+
+	s.SetRole(ctx, "g", "911", store.RoleModerator)
+	s.SetRole(ctx, "g", "800", store.RoleMember)
+	s.SetRole(ctx, "other", "911", store.RoleAdmin)
+
+	if err := s.SetRole(ctx, "g", "911", store.RoleAdmin); err != nil {
+		t.Fatalf("SetRole over an existing role: %v", err)
+	}
+	if role, ok, err := s.GetRole(ctx, "g", "911"); role != store.RoleAdmin || !ok || err != nil {
+		t.Errorf("GetRole = %q, %v, %v; want admin", role, ok, err)
+	}
+
+	roles, err := s.ListRoles(ctx, "g")
+	want := []store.RoleAssignment{{User: "800", Role: store.RoleMember}, {User: "911", Role: store.RoleAdmin}}
+	if err != nil || !slices.Equal(roles, want) {
+		t.Errorf("ListRoles = %v, %v; want %v", roles, err, want)
+	}
+
+	if err := s.ClearRole(ctx, "g", "911"); err != nil {
+		t.Fatalf("ClearRole: %v", err)
+	}
+	if _, ok, _ := s.GetRole(ctx, "g", "911"); ok {
+		t.Error("role survived ClearRole")
+	}
+	if role, _, _ := s.GetRole(ctx, "other", "911"); role != store.RoleAdmin {
+		t.Errorf("other group's role = %q, want admin", role)
+	}
+	if roles, _ := s.ListRoles(ctx, "empty"); roles == nil {
+		t.Error("ListRoles of an empty group is nil")
+	}
+}
+
+func testAudit(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Second)
+
+	if entries, err := s.ListAuditEntries(ctx, "g", 10); err != nil || len(entries) != 0 {
+		t.Fatalf("ListAuditEntries on an empty log = %v, %v; want none", entries, err)
+	}
+
+	added, err := s.AddAuditEntry(ctx, "g", store.AuditEntry{
+		Actor:   "alice",
+		Command: "p add",
+		Entity:  "pin",
+		Target:  "1",
+		After:   `{"Content":"slides"}`,
+	})
+	if err != nil {
+		t.Fatalf("AddAuditEntry: %v", err)
+	}
+	if added.At.Before(before) || added.At.After(time.Now()) {
+		t.Errorf("AddAuditEntry At = %v, want now", added.At)
+	}
+
+	s.AddAuditEntry(ctx, "other", store.AuditEntry{Actor: "mallory", Command: "b del", Entity: "basket", Target: "notes"})
+	deleted, _ := s.AddAuditEntry(ctx, "g", store.AuditEntry{
+		Actor:   "bob",
+		Command: "p del",
+		Entity:  "pin",
+		Target:  "1",
+		Before:  `{"Content":"slides"}`,
+	})
+
+	entries, err := s.ListAuditEntries(ctx, "g", 10)
+	if err != nil {
+		t.Fatalf("ListAuditEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0] != deleted || entries[1] != added {
+		t.Errorf("ListAuditEntries = %+v, want %+v newest first", entries, []store.AuditEntry{deleted, added})
+	}
+
+	if entries, _ := s.ListAuditEntries(ctx, "g", 1); len(entries) != 1 || entries[0].ID != deleted.ID {
+		t.Errorf("ListAuditEntries(1) = %+v, want only the newest", entries)
+	}
+}
+
+func testWithAudit(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	s.AddBasket(ctx, "g", "notes")
+	first, _ := s.AddPin(ctx, "g", "notes", store.Pin{Content: "first"})
+	s.AddPin(ctx, "g", "notes", store.Pin{Content: "second"})
+
+	err := s.WithAudit(ctx, "g", func(s store.Store) (store.AuditEntry, error) {
+		d, err := s.AddDeadline(ctx, "g", "essay", at(48*time.Hour), nil, store.Recurrence{}, "alice")
+		if err != nil {
+			return store.AuditEntry{}, err
+		}
+		return store.AuditEntry{Actor: "alice", Command: "d add", Entity: "deadline", Target: fmt.Sprint(d.ID)}, nil
+	})
+	if err != nil {
+		t.Fatalf("WithAudit: %v", err)
+	}
+	if list, _ := s.ListDeadlines(ctx, "g"); !slices.Equal(titles(list), []string{"essay"}) {
+		t.Errorf("ListDeadlines after WithAudit = %v, want essay", titles(list))
+	}
+	if entries, _ := s.ListAuditEntries(ctx, "g", 10); len(entries) != 1 || entries[0].Command != "d add" {
+		t.Errorf("ListAuditEntries after WithAudit = %+v, want the d add", entries)
+	}
+	select {
+	case <-s.Changes():
+	default:
+		t.Error("no change signalled after adding a deadline within WithAudit")
+	}
+
+	failed := errors.New("failed")
+	err = s.WithAudit(ctx, "g", func(s store.Store) (store.AuditEntry, error) {
+		s.SetBasketDescription(ctx, "g", "notes", "changed")
+		s.SetPinPosition(ctx, "g", first.ID, 2)
+		s.AddBasket(ctx, "g", "links")
+		return store.AuditEntry{}, failed
+	})
+	if err != failed {
+		t.Fatalf("WithAudit = %v, want the error of change", err)
+	}
+
+	if baskets, _ := s.ListBaskets(ctx, "g"); !slices.Equal(basketNames(baskets), []string{"notes"}) || baskets[0].Description != "" {
+		t.Errorf("ListBaskets after a failed change = %+v, want notes as it was", baskets)
+	}
+	if pins, _ := s.ListPins(ctx, "g", "notes"); len(pins) != 2 || pins[0].ID != first.ID {
+		t.Errorf("ListPins after a failed change = %+v, want the first pin still first", pins)
+	}
+	if entries, _ := s.ListAuditEntries(ctx, "g", 10); len(entries) != 1 {
+		t.Errorf("ListAuditEntries after a failed change = %+v, want nothing more", entries)
+	}
+
+	err = s.WithAudit(ctx, "g", func(s store.Store) (store.AuditEntry, error) {
+		return store.AuditEntry{Actor: "alice", Command: "b rename", Entity: "basket", Target: "notes", Before: `{"Name":"notes"}`, After: `{"Name":"notes"}`}, nil
+	})
+	if err != nil {
+		t.Fatalf("WithAudit of no change: %v", err)
+	}
+	if entries, _ := s.ListAuditEntries(ctx, "g", 10); len(entries) != 1 {
+		t.Errorf("ListAuditEntries after no change = %+v, want nothing more", entries)
+	}
+
+	// Taken names must be reported as such, and leave the transaction usable.
+	s.AddBasket(ctx, "g", "old")
+	s.DeleteBasket(ctx, "g", "old")
+	err = s.WithAudit(ctx, "g", func(s store.Store) (store.AuditEntry, error) {
+		if err := s.AddBasket(ctx, "g", "Notes"); err != store.ErrBasketExists {
+			t.Errorf("AddBasket of a taken name = %v, want %v", err, store.ErrBasketExists)
+		}
+		if err := s.RenameBasket(ctx, "g", "notes", "old"); err != store.ErrBasketInTrash {
+			t.Errorf("RenameBasket to a trashed name = %v, want %v", err, store.ErrBasketInTrash)
+		}
+		if err := s.AddBasket(ctx, "g", "links"); err != nil {
+			return store.AuditEntry{}, err
+		}
+		if err := s.RenameBasket(ctx, "g", "links", "notes"); err != store.ErrBasketExists {
+			t.Errorf("RenameBasket to a taken name = %v, want %v", err, store.ErrBasketExists)
+		}
+		return store.AuditEntry{Actor: "alice", Command: "b add", Entity: "basket", Target: "links"}, nil
+	})
+	if err != nil {
+		t.Fatalf("WithAudit after taken names: %v", err)
+	}
+	if baskets, _ := s.ListBaskets(ctx, "g"); !slices.Equal(basketNames(baskets), []string{"links", "notes"}) {
+		t.Errorf("ListBaskets after taken names = %v, want links and notes", basketNames(baskets))
+	}
+}
+
+func testChanges(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	d, _ := s.AddDeadline(ctx, "g", "essay", at(48*time.Hour), nil, store.Recurrence{}, "")
+
+	select {
+	case <-s.Changes():
+	default:
+		t.Fatal("no change signalled after AddDeadline")
+	}
+
+	s.DeleteDeadline(ctx, "g", d.ID)
+
+	select {
+	case <-s.Changes():
+	default:
+		t.Error("no change signalled after DeleteDeadline")
+	}
+}
+
+// Users see error messages as they are, so every store must return the same
+// ones.
+func testErrors(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	d, _ := s.AddDeadline(ctx, "g", "essay", at(48*time.Hour), nil, store.Recurrence{}, "")
+	s.AddBasket(ctx, "g", "notes")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+		msg  string
+	}{
+		{"GetDeadline", errOf(s.GetDeadline(ctx, "g", d.ID+1)), store.ErrDeadlineNotFound, "deadline does not exist"},
+		{"UpdateDeadline", errOf(s.UpdateDeadline(ctx, "g", d.ID+1, "x", at(time.Hour), "")), store.ErrDeadlineNotFound, "deadline does not exist"},
+		{"SetReminders", errOf(s.SetReminders(ctx, "g", d.ID+1, nil, "")), store.ErrDeadlineNotFound, "deadline does not exist"},
+		{"DeleteDeadline", s.DeleteDeadline(ctx, "g", d.ID+1), store.ErrDeadlineNotFound, "deadline does not exist"},
+		{"AddBasket", s.AddBasket(ctx, "g", "Notes"), store.ErrBasketExists, "basket already exists"},
+		{"DeleteBasket", s.DeleteBasket(ctx, "g", "missing"), store.ErrBasketNotFound, "basket does not exist"},
+		{"RenameBasket", s.RenameBasket(ctx, "g", "missing", "x"), store.ErrBasketNotFound, "basket does not exist"},
+		{"SetBasketDescription", s.SetBasketDescription(ctx, "g", "missing", "x"), store.ErrBasketNotFound, "basket does not exist"},
+		{"RestoreBasket", s.RestoreBasket(ctx, "g", "notes"), store.ErrNotInTrash, "basket is not in the trash"},
+		{"ClearRole", s.ClearRole(ctx, "g", "911"), store.ErrRoleNotSet, "no role was set for this member"},
+		{"AddPin", errOf(s.AddPin(ctx, "g", "missing", store.Pin{Content: "x"})), store.ErrBasketNotFound, "basket does not exist"},
+		{"ListPins", errOf(s.ListPins(ctx, "g", "missing")), store.ErrBasketNotFound, "basket does not exist"},
+		{"GetPin", errOf(s.GetPin(ctx, "g", 1)), store.ErrPinNotFound, "pin does not exist"},
+		{"DeletePin", s.DeletePin(ctx, "g", 1), store.ErrPinNotFound, "pin does not exist"},
+		{"EditPin", s.EditPin(ctx, "g", 1, "x", ""), store.ErrPinNotFound, "pin does not exist"},
+		{"MovePin", s.MovePin(ctx, "g", 1, "notes", ""), store.ErrPinNotFound, "pin does not exist"},
+		{"SetPinPosition", s.SetPinPosition(ctx, "g", 1, 1), store.ErrPinNotFound, "pin does not exist"},
+		{"MarkDelivered", s.MarkDelivered(ctx, 1), store.ErrMessageNotFound, "message not found"},
+		{"MarkFailed", s.MarkFailed(ctx, 1, "x", time.Time{}), store.ErrMessageNotFound, "message not found"},
+		{"ApplyDeadlineChanges", s.ApplyDeadlineChanges(ctx, []store.DeadlineChange{{From: store.Deadline{ID: d.ID + 1}, Delete: true}}, nil), store.ErrStaleDeadline, "deadline changed since it was read"},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) || tt.err.Error() != tt.msg {
+			t.Errorf("%s error = %v, want %q", tt.name, tt.err, tt.msg)
+		}
+	}
+}
+
+func errOf[T any](_ T, err error) error {
+	return err
+}
+
+func testOrdering(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	for _, h := range []int{5, 2, 9, 1} {
+		s.AddDeadline(ctx, "g", fmt.Sprint(h), at(time.Duration(h)*24*time.Hour), nil, store.Recurrence{}, "")
+	}
+	list, _ := s.ListDeadlines(ctx, "g")
+	if want := []string{"1", "2", "5", "9"}; !slices.Equal(titles(list), want) {
+		t.Errorf("ListDeadlines = %v, want %v", titles(list), want)
+	}
+
+	for _, name := range []string{"zeta", "Alpha", "mid", "beta"} {
+		s.AddBasket(ctx, "g", name)
+	}
+	baskets, _ := s.ListBaskets(ctx, "g")
+	if want := []string{"alpha", "beta", "mid", "zeta"}; !slices.Equal(basketNames(baskets), want) {
+		t.Errorf("ListBaskets = %v, want %v", basketNames(baskets), want)
+	}
+
+	// Pins keep the order they were added in.
+	var want []string
+	for _, content := range []string{"c", "a", "b"} {
+		s.AddPin(ctx, "g", "mid", store.Pin{Content: content})
+		want = append(want, content)
+	}
+	pins, _ := s.ListPins(ctx, "g", "mid")
+	var got []string
+	for _, p := range pins {
+		got = append(got, p.Content)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ListPins = %v, want %v", got, want)
+	}
+
+	// Empty results are empty slices, not nil.
+	if list, _ := s.ListDeadlines(ctx, "empty"); list == nil {
+		t.Error("ListDeadlines of an empty group is nil")
+	}
+	if baskets, _ := s.ListBaskets(ctx, "empty"); baskets == nil {
+		t.Error("ListBaskets of an empty group is nil")
+	}
+	s.AddBasket(ctx, "g", "empty")
+	if pins, _ := s.ListPins(ctx, "g", "empty"); pins == nil {
+		t.Error("ListPins of an empty basket is nil")
+	}
+}
+
+func testConcurrent(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	s.AddBasket(ctx, "g", "notes")
+
+	const workers, each = 8, 5
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				if _, err := s.AddDeadline(ctx, "g", fmt.Sprintf("%d-%d", w, i), at(48*time.Hour), nil, store.Recurrence{}, ""); err != nil {
+					t.Errorf("AddDeadline: %v", err)
+				}
+				if _, err := s.AddPin(ctx, "g", "notes", store.Pin{Content: "x"}); err != nil {
+					t.Errorf("AddPin: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if list, _ := s.ListDeadlines(ctx, "g"); len(list) != workers*each {
+		t.Errorf("%d deadlines, want %d", len(list), workers*each)
+	}
+	if pins, _ := s.ListPins(ctx, "g", "notes"); len(pins) != workers*each {
+		t.Errorf("%d pins, want %d", len(pins), workers*each)
+	}
+}
@@ -0,0 +1,99 @@
+package wa
+
+import (
+	"context"
+	"time"
+
+	waTypes "go.mau.fi/whatsmeow/types"
+)
+
+// Group admins are looked up again after this long, in case a change was
+// missed while the bot was offline.
+const adminCacheTTL = 10 * time.Minute
+
+// A failed lookup is remembered this long, so that while WhatsApp refuses
+// them not every command waits on another one.
+const adminRetryAfter = 30 * time.Second
+
+type groupAdmins struct {
+	users   map[string]bool // phone numbers and LIDs
+	err     error           // why the lookup failed, users is then nil
+	fetched time.Time
+}
+
+func (a groupAdmins) expired() bool {
+	if a.err != nil {
+		return time.Since(a.fetched) > adminRetryAfter
+	}
+	return time.Since(a.fetched) > adminCacheTTL
+}
+
+// IsAdmin reports whether user is an admin of the group chat, looking the
+// admins up at most every adminCacheTTL, or adminRetryAfter after a failed
+// lookup.
+func (m *Messenger) IsAdmin(ctx context.Context, chatID string, user string) (bool, error) {
+	userJID, err := waTypes.ParseJID(user)
+	if err != nil {
+		return false, err
+	}
+
+	m.adminsMu.Lock()
+	admins, ok := m.admins[chatID]
+	m.adminsMu.Unlock()
+
+	if !ok || admins.expired() {
+		admins, err = m.fetchAdmins(ctx, chatID)
+		if err != nil {
+			admins = groupAdmins{err: err, fetched: time.Now()}
+		}
+
+		m.adminsMu.Lock()
+		m.admins[chatID] = admins
+		m.adminsMu.Unlock()
+	}
+
+	if admins.err != nil {
+		return false, admins.err
+	}
+
+	return admins.users[userJID.User], nil
+}
+
+func (m *Messenger) fetchAdmins(ctx context.Context, chatID string) (groupAdmins, error) {
+	jid, err := waTypes.ParseJID(chatID)
+	if err != nil {
+		return groupAdmins{}, err
+	}
+
+	info, err := m.client.GetGroupInfo(ctx, jid)
+	if err != nil {
+		return groupAdmins{}, err
+	}
+
+	admins := groupAdmins{users: map[string]bool{}, fetched: time.Now()}
+
+	// Senders show up by phone number or by LID depending on the group, so
+	// both are kept.
+	for _, p := range info.Participants {
+		if !p.IsAdmin && !p.IsSuperAdmin {
+			continue
+		}
+
+		for _, j := range []waTypes.JID{p.JID, p.PhoneNumber, p.LID} {
+			if !j.IsEmpty() {
+				admins.users[j.User] = true
+			}
+		}
+	}
+
+	return admins, nil
+}
+
+// forgetAdmins drops the cached admins of a chat, so they are looked up again
+// when next needed.
+func (m *Messenger) forgetAdmins(chatID string) {
+	m.adminsMu.Lock()
+	defer m.adminsMu.Unlock()
+
+	delete(m.admins, chatID)
+}
@@ -0,0 +1,254 @@
+package wa
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/kaezrr/remy-bot/internal/chat"
+
+	"go.mau.fi/whatsmeow"
+	waE2E "go.mau.fi/whatsmeow/proto/waE2E"
+	waTypes "go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Messenger is the whatsmeow implementation of chat.Messenger.
+type Messenger struct {
+	client *whatsmeow.Client
+
+	adminsMu sync.Mutex
+	admins   map[string]groupAdmins // by chat ID
+}
+
+func NewMessenger(client *whatsmeow.Client) *Messenger {
+	return &Messenger{client: client, admins: map[string]groupAdmins{}}
+}
+
+func (m *Messenger) SendText(ctx context.Context, chatID string, text string) error {
+	jid, err := waTypes.ParseJID(chatID)
+	if err != nil {
+		return err
+	}
+
+	waMsg := &waE2E.Message{
+		Conversation: proto.String(text),
+	}
+
+	_, err = m.client.SendMessage(ctx, jid, waMsg)
+	return err
+}
+
+// SendTextKeyed sends text with a message ID derived from key, so that a
+// resend after a crash carries the same ID as the first copy. Whether
+// WhatsApp clients then show it once is up to them.
+func (m *Messenger) SendTextKeyed(ctx context.Context, chatID string, key string, text string) error {
+	jid, err := waTypes.ParseJID(chatID)
+	if err != nil {
+		return err
+	}
+
+	waMsg := &waE2E.Message{
+		Conversation: proto.String(text),
+	}
+
+	id := whatsmeow.WebMessageIDPrefix + strings.ToUpper(key)
+
+	_, err = m.client.SendMessage(ctx, jid, waMsg, whatsmeow.SendRequestExtra{ID: id})
+	return err
+}
+
+func (m *Messenger) SendReply(ctx context.Context, msg chat.Message, text string) error {
+	jid, err := waTypes.ParseJID(msg.Chat)
+	if err != nil {
+		return err
+	}
+
+	waMsg := &waE2E.Message{
+		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String(text),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      proto.String(msg.ID),
+				Participant:   proto.String(msg.Sender),
+				QuotedMessage: &waE2E.Message{Conversation: proto.String(msg.Text)},
+			},
+		},
+	}
+
+	_, err = m.client.SendMessage(ctx, jid, waMsg)
+	return err
+}
+
+func (m *Messenger) React(ctx context.Context, msg chat.Message, emoji string) error {
+	chatJID, err := waTypes.ParseJID(msg.Chat)
+	if err != nil {
+		return err
+	}
+
+	senderJID, err := waTypes.ParseJID(msg.Sender)
+	if err != nil {
+		return err
+	}
+
+	reaction := m.client.BuildReaction(chatJID, senderJID, msg.ID, emoji)
+
+	_, err = m.client.SendMessage(ctx, chatJID, reaction)
+	return err
+}
+
+func (m *Messenger) ResolveChat(ctx context.Context, name string) (string, error) {
+	groups, err := m.client.GetJoinedGroups(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, g := range groups {
+		if g.GroupName.Name == name {
+			return g.JID.String(), nil
+		}
+	}
+
+	return "", chat.ErrChatNotFound
+}
+
+var (
+	_ chat.Messenger   = (*Messenger)(nil)
+	_ chat.KeyedSender = (*Messenger)(nil)
+)
+
+// attachment returns the file of msg and its caption, or nil if msg has none.
+func (m *Messenger) attachment(msg *waE2E.Message) (*chat.Attachment, string) {
+	var (
+		a       chat.Attachment
+		file    whatsmeow.DownloadableMessage
+		caption string
+	)
+
+	switch {
+	case msg.GetImageMessage() != nil:
+		v := msg.GetImageMessage()
+		a = chat.Attachment{Kind: "image", MIME: v.GetMimetype(), Size: int64(v.GetFileLength())}
+		file, caption = v, v.GetCaption()
+	case msg.GetVideoMessage() != nil:
+		v := msg.GetVideoMessage()
+		a = chat.Attachment{Kind: "video", MIME: v.GetMimetype(), Size: int64(v.GetFileLength())}
+		file, caption = v, v.GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		v := msg.GetDocumentMessage()
+		a = chat.Attachment{Kind: "document", MIME: v.GetMimetype(), Name: v.GetFileName(), Size: int64(v.GetFileLength())}
+		file, caption = v, v.GetCaption()
+	case msg.GetAudioMessage() != nil:
+		v := msg.GetAudioMessage()
+		a = chat.Attachment{Kind: "audio", MIME: v.GetMimetype(), Size: int64(v.GetFileLength())}
+		file = v
+	case msg.GetStickerMessage() != nil:
+		v := msg.GetStickerMessage()
+		a = chat.Attachment{Kind: "sticker", MIME: v.GetMimetype(), Size: int64(v.GetFileLength())}
+		file = v
+	default:
+		return nil, ""
+	}
+
+	a.Download = func(ctx context.Context) ([]byte, error) {
+		return m.client.Download(ctx, file)
+	}
+
+	return &a, caption
+}
+
+// SendMedia uploads file and sends it to the chat. Audio and stickers can't
+// have a caption, so it follows them as a separate message.
+func (m *Messenger) SendMedia(ctx context.Context, chatID string, file chat.File, caption string) error {
+	jid, err := waTypes.ParseJID(chatID)
+	if err != nil {
+		return err
+	}
+
+	mediaType := whatsmeow.MediaDocument
+	switch file.Kind {
+	case "image", "sticker":
+		mediaType = whatsmeow.MediaImage
+	case "video":
+		mediaType = whatsmeow.MediaVideo
+	case "audio":
+		mediaType = whatsmeow.MediaAudio
+	}
+
+	up, err := m.client.Upload(ctx, file.Data, mediaType)
+	if err != nil {
+		return err
+	}
+
+	var (
+		waMsg       waE2E.Message
+		sendCaption bool
+	)
+
+	switch file.Kind {
+	case "image":
+		waMsg.ImageMessage = &waE2E.ImageMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(file.MIME),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	case "video":
+		waMsg.VideoMessage = &waE2E.VideoMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(file.MIME),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	case "audio":
+		waMsg.AudioMessage = &waE2E.AudioMessage{
+			Mimetype:      proto.String(file.MIME),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+		sendCaption = caption != ""
+	case "sticker":
+		waMsg.StickerMessage = &waE2E.StickerMessage{
+			Mimetype:      proto.String(file.MIME),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+		sendCaption = caption != ""
+	default:
+		waMsg.DocumentMessage = &waE2E.DocumentMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(file.MIME),
+			FileName:      proto.String(file.Name),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	}
+
+	if _, err := m.client.SendMessage(ctx, jid, &waMsg); err != nil {
+		return err
+	}
+
+	if sendCaption {
+		return m.SendText(ctx, chatID, caption)
+	}
+	return nil
+}
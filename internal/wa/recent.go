@@ -0,0 +1,45 @@
+package wa
+
+import (
+	"sync"
+	"time"
+)
+
+// recentTimes remembers when the last few thousand messages were sent. A
+// reply only carries the ID of the message it quotes, and WhatsApp can't be
+// asked for an old message, so this is the only way to know when it was sent.
+type recentTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+	order []string // oldest first
+	size  int
+}
+
+func newRecentTimes(size int) *recentTimes {
+	return &recentTimes{times: make(map[string]time.Time, size), size: size}
+}
+
+func (r *recentTimes) Add(id string, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.times[id]; ok {
+		return
+	}
+
+	r.times[id] = t
+	r.order = append(r.order, id)
+
+	if len(r.order) > r.size {
+		delete(r.times, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// Get returns when message id was sent, or the zero time if it is unknown.
+func (r *recentTimes) Get(id string) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.times[id]
+}
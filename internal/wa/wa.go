@@ -3,40 +3,33 @@ package wa
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
-	"github.com/kaezrr/remy-bot/internal/bot"
+	"github.com/kaezrr/remy-bot/internal/app"
+	"github.com/kaezrr/remy-bot/internal/chat"
 	"github.com/kaezrr/remy-bot/internal/config"
 	"github.com/kaezrr/remy-bot/internal/job"
+	"github.com/kaezrr/remy-bot/internal/media"
 	"github.com/kaezrr/remy-bot/internal/store"
 	"github.com/rs/zerolog/log"
 
 	"go.mau.fi/whatsmeow"
-	waE2E "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waE2E"
 	waStore "go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
-	waTypes "go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	"google.golang.org/protobuf/proto"
 
 	qrterminal "github.com/mdp/qrterminal/v3"
 )
 
-type BotHandleFunc func(ctx context.Context, input, prefix string, s store.Store) bot.Response
-
-func sendGroupMessage(client *whatsmeow.Client, jid waTypes.JID, text string) {
-	waMsg := &waE2E.Message{
-		Conversation: proto.String(text),
-	}
-	if _, err := client.SendMessage(context.Background(), jid, waMsg); err != nil {
-		log.Error().Err(err).Str("jid", jid.String()).Msg("failed to send group message")
-	}
-}
-
-func Run(cfg *config.Config, s store.Store, handle BotHandleFunc) error {
+// Run serves the target groups of cfg over WhatsApp. claim is called with the
+// first of them once it is resolved, before anything else is done with s.
+func Run(cfg *config.Config, s store.Store, handle app.HandleFunc, claim func(group string) error) error {
 	container, err := waStore.New(
 		context.Background(),
 		"sqlite",
@@ -99,46 +92,78 @@ func Run(cfg *config.Config, s store.Store, handle BotHandleFunc) error {
 		return fmt.Errorf("timeout waiting for WhatsApp connection after 30 seconds")
 	}
 
-	groups, err := client.GetJoinedGroups(context.Background())
-	if err != nil {
-		return err
-	}
+	messenger := NewMessenger(client)
 
-	var targetJID waTypes.JID
-	for _, g := range groups {
-		if g.GroupName.Name == cfg.TargetGroupName {
-			targetJID = g.JID
-			break
+	chats := make(map[string]bool, len(cfg.TargetGroups))
+	var first string
+	for _, name := range cfg.TargetGroups {
+		jid, err := messenger.ResolveChat(context.Background(), name)
+		if err != nil {
+			return fmt.Errorf("target group %q: %w", name, err)
 		}
-	}
-	if targetJID.IsEmpty() {
-		return fmt.Errorf("target group %q not found", cfg.TargetGroupName)
+
+		chats[jid] = true
+		if first == "" {
+			first = jid
+		}
+
+		log.Info().
+			Str("group_name", name).
+			Str("group_jid", jid).
+			Msg("target WhatsApp group resolved")
 	}
 
-	log.Info().
-		Str("group_name", cfg.TargetGroupName).
-		Str("group_jid", targetJID.String()).
-		Msg("target WhatsApp group resolved")
+	if err := claim(first); err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	manager := job.DeadlineManager{
-		Client:    client,
+		Messenger: messenger,
+		Store:     s,
+		CatchUp:   job.CatchUpPolicy(cfg.MissedReminders),
+		Groups:    slices.Collect(maps.Keys(chats)),
+	}
+
+	purger := job.TrashPurger{
 		Store:     s,
-		TargetJID: targetJID,
+		Retention: cfg.TrashRetention(),
+		Media:     media.Dir(cfg.MediaDir),
+		Groups:    manager.Groups,
+	}
+
+	dispatcher := app.Dispatcher{
+		Messenger: messenger,
+		Store:     s,
+		Handle:    handle,
+		Prefix:    cfg.Prefix,
+		Chats:     chats,
+		Media:     media.Dir(cfg.MediaDir),
 	}
 
 	// Send availability presence to whatsapp
 	client.SendPresence(ctx, types.PresenceAvailable)
 
 	go manager.Start(ctx)
+	go purger.Start(ctx)
+
+	announce(messenger, chats, "Remy has entered the chat. Type .h for help!")
 
-	sendGroupMessage(client, targetJID, "Remy has entered the chat. Type .h for help!")
+	recent := newRecentTimes(5000)
 
 	client.AddEventHandler(func(evt any) {
 		switch v := evt.(type) {
 		case *events.Message:
-			handleIncomingMessage(client, v, cfg, s, handle, targetJID)
+			recent.Add(v.Info.ID, v.Info.Timestamp)
+
+			if msg, ok := toChatMessage(v, recent, messenger); ok {
+				dispatcher.Enqueue(msg)
+			}
+
+		case *events.GroupInfo:
+			// Admins may have been promoted or demoted.
+			messenger.forgetAdmins(v.JID.String())
 		}
 	})
 
@@ -149,7 +174,7 @@ func Run(cfg *config.Config, s store.Store, handle BotHandleFunc) error {
 	// Shutdown deadline manager
 	cancel()
 
-	sendGroupMessage(client, targetJID, "Remy left the chat. See you soon!")
+	announce(messenger, chats, "Remy left the chat. See you soon!")
 
 	log.Info().Msg("shutting down Remy, goodbye...")
 
@@ -157,37 +182,78 @@ func Run(cfg *config.Config, s store.Store, handle BotHandleFunc) error {
 	return nil
 }
 
-func handleIncomingMessage(
-	client *whatsmeow.Client,
-	msg *events.Message,
-	cfg *config.Config,
-	s store.Store,
-	handle BotHandleFunc,
-	targetJID waTypes.JID,
-) {
-	if msg.Info.MessageSource.IsFromMe {
-		return
+func announce(m chat.Messenger, chats map[string]bool, text string) {
+	for c := range chats {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := m.SendText(ctx, c, text); err != nil {
+			log.Error().Err(err).Str("jid", c).Msg("failed to send group message")
+		}
+		cancel()
 	}
+}
 
-	if !msg.Info.IsGroup || msg.Info.Chat != targetJID {
-		return
+// toChatMessage converts a whatsmeow message event into a chat.Message. It
+// reports false for messages that are not group messages with text or a
+// caption. The time of a quoted message is looked up in recent, and files are
+// downloaded through m.
+func toChatMessage(msg *events.Message, recent *recentTimes, m *Messenger) (chat.Message, bool) {
+	if !msg.Info.IsGroup {
+		return chat.Message{}, false
 	}
 
+	attachment, caption := m.attachment(msg.Message)
+
 	text := msg.Message.GetConversation()
 	if text == "" && msg.Message.ExtendedTextMessage != nil {
 		text = msg.Message.ExtendedTextMessage.GetText()
 	}
+	if text == "" && attachment != nil {
+		text = caption
+	}
 	if text == "" {
-		return
+		return chat.Message{}, false
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	out := chat.Message{
+		ID:         msg.Info.ID,
+		Chat:       msg.Info.Chat.String(),
+		Sender:     msg.Info.Sender.String(),
+		SenderName: msg.Info.PushName,
+		Text:       text,
+		Time:       msg.Info.Timestamp,
+		IsFromMe:   msg.Info.MessageSource.IsFromMe,
+		Attachment: attachment,
+	}
 
-	resp := handle(ctx, text, cfg.Prefix, s)
-	if resp.Text == "" {
-		return
+	ctxInfo := msg.Message.GetExtendedTextMessage().GetContextInfo()
+	if id := ctxInfo.GetStanzaID(); id != "" {
+		quoted := ctxInfo.GetQuotedMessage()
+		out.Quoted = &chat.Message{
+			ID:     id,
+			Sender: ctxInfo.GetParticipant(),
+			Text:   quotedText(quoted),
+			Time:   recent.Get(id),
+		}
+		out.Quoted.Attachment, _ = m.attachment(quoted)
 	}
 
-	sendGroupMessage(client, targetJID, resp.Text)
+	return out, true
+}
+
+// quotedText returns the text of a quoted message, which is the caption for
+// media.
+func quotedText(m *waE2E.Message) string {
+	switch {
+	case m.GetConversation() != "":
+		return m.GetConversation()
+	case m.GetExtendedTextMessage() != nil:
+		return m.GetExtendedTextMessage().GetText()
+	case m.GetImageMessage() != nil:
+		return m.GetImageMessage().GetCaption()
+	case m.GetVideoMessage() != nil:
+		return m.GetVideoMessage().GetCaption()
+	case m.GetDocumentMessage() != nil:
+		return m.GetDocumentMessage().GetCaption()
+	}
+	return ""
 }